@@ -0,0 +1,376 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Errors reported by the audio helpers.
+var (
+	// ErrUnsupportedAudioType means the audio format is not recognized or
+	// not accepted by the provider.
+	ErrUnsupportedAudioType = errors.New("unsupported audio type")
+	// ErrAudioTooLarge means the audio exceeds the provider's size or
+	// duration limit.
+	ErrAudioTooLarge = errors.New("audio too large")
+)
+
+// NewAudioBlock creates a base64 audio content block. duration may be
+// zero if unknown.
+func NewAudioBlock(mediaType MediaType, base64Data string, duration time.Duration) ContentBlock {
+	return ContentBlock{
+		Type: ContentTypeAudio,
+		Audio: &AudioContent{
+			Source: AudioSource{
+				Type:      "base64",
+				MediaType: mediaType,
+				Data:      base64Data,
+			},
+			Duration: duration,
+		},
+	}
+}
+
+// NewAudioBlockFromFile reads an audio file and returns it as a base64
+// audio block. See NewAudioBlockFromReader.
+func NewAudioBlockFromFile(path string, caps Capabilities) (ContentBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+	defer f.Close()
+	block, err := NewAudioBlockFromReader(f, caps)
+	if err != nil {
+		return ContentBlock{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return block, nil
+}
+
+// NewAudioBlockFromReader reads WAV, MP3, OGG (Vorbis or Opus) or FLAC
+// audio and returns it as a base64 audio block, with the media type
+// sniffed from the data and the duration read from its header.
+//
+// The audio is checked against caps' SupportedAudioTypes, MaxAudioSize
+// and MaxAudioDuration; audio whose duration cannot be read is rejected
+// only when MaxAudioDuration is set. Whether the provider supports audio
+// at all is not checked; see Negotiate.
+func NewAudioBlockFromReader(r io.Reader, caps Capabilities) (ContentBlock, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ContentBlock{}, fmt.Errorf("read audio: %w", err)
+	}
+	mediaType, err := SniffAudioType(data)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+	if len(caps.SupportedAudioTypes) > 0 && !containsString(caps.SupportedAudioTypes, string(mediaType)) {
+		return ContentBlock{}, fmt.Errorf("%w: %s is not accepted", ErrUnsupportedAudioType, mediaType)
+	}
+	if caps.MaxAudioSize > 0 && int64(len(data)) > caps.MaxAudioSize {
+		return ContentBlock{}, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrAudioTooLarge, len(data), caps.MaxAudioSize)
+	}
+
+	duration, err := AudioDuration(data)
+	if caps.MaxAudioDuration > 0 {
+		if err != nil {
+			return ContentBlock{}, fmt.Errorf("cannot check duration limit: %w", err)
+		}
+		if duration > caps.MaxAudioDuration {
+			return ContentBlock{}, fmt.Errorf("%w: duration %v exceeds limit of %v", ErrAudioTooLarge, duration, caps.MaxAudioDuration)
+		}
+	}
+	return NewAudioBlock(mediaType, base64.StdEncoding.EncodeToString(data), duration), nil
+}
+
+// SniffAudioType returns the media type of audio data, detected from its
+// content. It fails with ErrUnsupportedAudioType for anything other than
+// WAV, MP3, OGG or FLAC.
+func SniffAudioType(data []byte) (MediaType, error) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return MediaTypeWAV, nil
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return MediaTypeFLAC, nil
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return MediaTypeOGG, nil
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return MediaTypeMP3, nil
+	case len(data) >= 4:
+		if _, ok := parseMP3Header(binary.BigEndian.Uint32(data)); ok {
+			return MediaTypeMP3, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unrecognized audio format", ErrUnsupportedAudioType)
+}
+
+// AudioDuration returns the duration of WAV, MP3, OGG or FLAC audio, read
+// from its headers. MP3 durations come from a Xing/Info header when
+// present, and are otherwise estimated from the first frame's bitrate.
+func AudioDuration(data []byte) (time.Duration, error) {
+	mediaType, err := SniffAudioType(data)
+	if err != nil {
+		return 0, err
+	}
+	var d time.Duration
+	switch mediaType {
+	case MediaTypeWAV:
+		d, err = wavDuration(data)
+	case MediaTypeFLAC:
+		d, err = flacDuration(data)
+	case MediaTypeOGG:
+		d, err = oggDuration(data)
+	case MediaTypeMP3:
+		d, err = mp3Duration(data)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read %s duration: %w", mediaType, err)
+	}
+	return d, nil
+}
+
+// samplesDuration converts a sample count at rate samples per second to
+// a duration.
+func samplesDuration(samples, rate uint64) time.Duration {
+	return time.Duration(float64(samples) / float64(rate) * float64(time.Second))
+}
+
+// wavDuration divides the data chunk size by the byte rate from the fmt
+// chunk.
+func wavDuration(data []byte) (time.Duration, error) {
+	var byteRate uint32
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := binary.LittleEndian.Uint32(data[off+4 : off+8])
+		body := off + 8
+		switch id {
+		case "fmt ":
+			if size < 12 || body+12 > len(data) {
+				return 0, errors.New("truncated fmt chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8:])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("data chunk before fmt chunk")
+			}
+			return samplesDuration(uint64(size), uint64(byteRate)), nil
+		}
+		off = body + int(size) + int(size&1)
+	}
+	return 0, errors.New("no data chunk")
+}
+
+// flacDuration reads the sample rate and total samples from the
+// STREAMINFO block, which must come first.
+func flacDuration(data []byte) (time.Duration, error) {
+	if len(data) < 26 || data[4]&0x7f != 0 {
+		return 0, errors.New("missing STREAMINFO block")
+	}
+	// Sample rate (20 bits), channels (3), bits per sample (5) and total
+	// samples (36) are packed into 8 bytes.
+	v := binary.BigEndian.Uint64(data[18:26])
+	rate := v >> 44
+	total := v & (1<<36 - 1)
+	if rate == 0 || total == 0 {
+		return 0, errors.New("unknown sample rate or length")
+	}
+	return samplesDuration(total, rate), nil
+}
+
+// oggDuration divides the granule position of the last page by the
+// sample rate from the Vorbis or Opus identification header.
+func oggDuration(data []byte) (time.Duration, error) {
+	if len(data) < 27 {
+		return 0, errors.New("truncated page")
+	}
+	body := 27 + int(data[26])
+	if body >= len(data) {
+		return 0, errors.New("truncated page")
+	}
+	packet := data[body:]
+
+	var rate, preSkip uint64
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		rate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+		// Opus granule positions always count 48 kHz samples.
+		rate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0, errors.New("unsupported codec")
+	}
+	if rate == 0 {
+		return 0, errors.New("unknown sample rate")
+	}
+
+	// The last page with a valid header and checksum holds the final
+	// granule position. "OggS" may also occur inside packet data, and a
+	// torn final page fails its checksum.
+	for end := len(data); end > 0; {
+		last := bytes.LastIndex(data[:end], []byte("OggS"))
+		if last < 0 {
+			break
+		}
+		end = last
+		if !oggPageValid(data[last:]) {
+			continue
+		}
+		granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+		if granule == math.MaxUint64 {
+			// No packet ends on this page.
+			continue
+		}
+		if granule < preSkip {
+			return 0, nil
+		}
+		return samplesDuration(granule-preSkip, rate), nil
+	}
+	return 0, errors.New("no valid final page")
+}
+
+// oggPageValid reports whether data starts with a complete Ogg page whose
+// checksum matches.
+func oggPageValid(data []byte) bool {
+	if len(data) < 27 || !bytes.HasPrefix(data, []byte("OggS")) || data[4] != 0 {
+		return false
+	}
+	size := 27 + int(data[26])
+	if size > len(data) {
+		return false
+	}
+	for _, n := range data[27:size] {
+		size += int(n)
+	}
+	if size > len(data) {
+		return false
+	}
+	return binary.LittleEndian.Uint32(data[22:26]) == oggChecksum(data[:size])
+}
+
+// oggCRCTable is the table for the Ogg CRC-32 (polynomial 0x04c11db7,
+// unreflected, zero initial value).
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggChecksum computes the checksum of an Ogg page, treating its own
+// checksum field as zero.
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for i, b := range page {
+		if i >= 22 && i < 26 {
+			b = 0
+		}
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// mp3Frame describes an MPEG audio Layer III frame header.
+type mp3Frame struct {
+	mpeg1      bool
+	mono       bool
+	bitrate    int // bits per second
+	sampleRate int
+}
+
+var (
+	mp3Bitrates1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3Bitrates2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3Rates     = map[uint32][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// parseMP3Header decodes a 4-byte Layer III frame header.
+func parseMP3Header(h uint32) (mp3Frame, bool) {
+	if h>>21 != 0x7ff {
+		return mp3Frame{}, false
+	}
+	version := (h >> 19) & 3
+	layer := (h >> 17) & 3
+	bitrateIndex := (h >> 12) & 0xf
+	rateIndex := (h >> 10) & 3
+	rates, ok := mp3Rates[version]
+	if !ok || layer != 1 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+	frame := mp3Frame{
+		mpeg1:      version == 3,
+		mono:       (h>>6)&3 == 3,
+		sampleRate: rates[rateIndex],
+	}
+	if frame.mpeg1 {
+		frame.bitrate = mp3Bitrates1[bitrateIndex] * 1000
+	} else {
+		frame.bitrate = mp3Bitrates2[bitrateIndex] * 1000
+	}
+	if frame.bitrate == 0 {
+		return mp3Frame{}, false
+	}
+	return frame, true
+}
+
+// mp3Duration skips any ID3v2 tag, then uses the first frame's Xing/Info
+// frame count, or its bitrate if there is none.
+func mp3Duration(data []byte) (time.Duration, error) {
+	off := 0
+	if bytes.HasPrefix(data, []byte("ID3")) && len(data) >= 10 {
+		// The tag size is a 28-bit "syncsafe" integer.
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		off = 10 + size
+		if data[5]&0x10 != 0 {
+			off += 10 // footer
+		}
+	}
+
+	for ; off+4 <= len(data); off++ {
+		frame, ok := parseMP3Header(binary.BigEndian.Uint32(data[off:]))
+		if !ok {
+			continue
+		}
+		samplesPerFrame := 576
+		sideInfo := 17
+		if frame.mono {
+			sideInfo = 9
+		}
+		if frame.mpeg1 {
+			samplesPerFrame = 1152
+			sideInfo = 32
+			if frame.mono {
+				sideInfo = 17
+			}
+		}
+		xing := off + 4 + sideInfo
+		if xing+12 <= len(data) {
+			tag := string(data[xing : xing+4])
+			flags := binary.BigEndian.Uint32(data[xing+4:])
+			if (tag == "Xing" || tag == "Info") && flags&1 != 0 {
+				frames := binary.BigEndian.Uint32(data[xing+8:])
+				return samplesDuration(uint64(frames)*uint64(samplesPerFrame), uint64(frame.sampleRate)), nil
+			}
+		}
+		return samplesDuration(uint64(len(data)-off)*8, uint64(frame.bitrate)), nil
+	}
+	return 0, errors.New("no frame header")
+}
@@ -0,0 +1,152 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wavBytes builds a 16 kHz mono 16-bit WAV file of the given length.
+func wavBytes(seconds int) []byte {
+	const rate, byteRate = 16000, 32000
+	var b bytes.Buffer
+	dataSize := uint32(seconds * byteRate)
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, 36+dataSize)
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, []uint32{16})
+	binary.Write(&b, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&b, binary.LittleEndian, []uint32{rate, byteRate})
+	binary.Write(&b, binary.LittleEndian, []uint16{2, 16})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, dataSize)
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+func flacBytes(rate, samples uint64) []byte {
+	info := make([]byte, 34)
+	packed := rate<<44 | 1<<41 | 15<<36 | samples
+	binary.BigEndian.PutUint64(info[10:], packed)
+	return append([]byte("fLaC\x80\x00\x00\x22"), info...)
+}
+
+func oggPage(granule uint64, body []byte) []byte {
+	page := make([]byte, 27, 28+len(body))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	page[26] = 1
+	page = append(page, byte(len(body)))
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+	return page
+}
+
+func opusBytes(seconds int) []byte {
+	return opusPayload(seconds, []byte("audio"))
+}
+
+func opusPayload(seconds int, payload []byte) []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = binary.LittleEndian.AppendUint32(head, 16000)
+	head = append(head, 0, 0, 0)
+	data := oggPage(0, head)
+	return append(data, oggPage(uint64(seconds*48000+312), payload)...)
+}
+
+// TestAudioDuration tests reading durations from audio headers.
+func TestAudioDuration(t *testing.T) {
+	// MPEG-1 Layer III, 128 kbps, 44.1 kHz, stereo.
+	mp3Header := []byte{0xff, 0xfb, 0x90, 0x00}
+	cbr := append(append([]byte{}, mp3Header...), make([]byte, 16000-4)...)
+	xing := append(append([]byte{}, mp3Header...), make([]byte, 32)...)
+	xing = append(xing, "Xing\x00\x00\x00\x01\x00\x00\x00\x64"...)
+	xing = append(xing, make([]byte, 400)...)
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05hello"), cbr...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want MediaType
+		dur  time.Duration
+	}{
+		{"wav", wavBytes(2), MediaTypeWAV, 2 * time.Second},
+		{"flac", flacBytes(44100, 88200), MediaTypeFLAC, 2 * time.Second},
+		{"opus", opusBytes(3), MediaTypeOGG, 3 * time.Second},
+		// "OggS" inside the final packet, and a torn page after it.
+		{"opus payload", opusPayload(3, []byte("xxOggS\x00\x00\xff\xff\xff\xff\xff\xff\xff\x7fyy")), MediaTypeOGG, 3 * time.Second},
+		{"opus torn", append(opusBytes(3), oggPage(9*48000, []byte("audio"))[:30]...), MediaTypeOGG, 3 * time.Second},
+		{"mp3 cbr", cbr, MediaTypeMP3, time.Second},
+		{"mp3 id3", id3, MediaTypeMP3, time.Second},
+		{"mp3 xing", xing, MediaTypeMP3, 100 * 1152 * time.Second / 44100},
+	}
+	for _, tt := range tests {
+		mt, err := SniffAudioType(tt.data)
+		if err != nil || mt != tt.want {
+			t.Errorf("%s: SniffAudioType = %s, %v", tt.name, mt, err)
+			continue
+		}
+		d, err := AudioDuration(tt.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if diff := d - tt.dur; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: duration = %v, want %v", tt.name, d, tt.dur)
+		}
+	}
+
+	if _, err := SniffAudioType([]byte("plain text")); !errors.Is(err, ErrUnsupportedAudioType) {
+		t.Errorf("Expected ErrUnsupportedAudioType, got %v", err)
+	}
+}
+
+// TestNewAudioBlockFromFile tests loading and validating audio files.
+func TestNewAudioBlockFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.wav")
+	if err := os.WriteFile(path, wavBytes(2), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := NewAudioBlockFromFile(path, Capabilities{SupportsAudio: true, MaxAudioDuration: time.Minute})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if block.Type != ContentTypeAudio || block.Audio.Source.MediaType != MediaTypeWAV || block.Audio.Duration != 2*time.Second {
+		t.Errorf("Unexpected block: %+v", block.Audio)
+	}
+
+	_, err = NewAudioBlockFromFile(path, Capabilities{MaxAudioDuration: time.Second})
+	if !errors.Is(err, ErrAudioTooLarge) {
+		t.Errorf("Expected ErrAudioTooLarge for duration, got %v", err)
+	}
+	_, err = NewAudioBlockFromFile(path, Capabilities{MaxAudioSize: 1000})
+	if !errors.Is(err, ErrAudioTooLarge) {
+		t.Errorf("Expected ErrAudioTooLarge for size, got %v", err)
+	}
+	_, err = NewAudioBlockFromFile(path, Capabilities{SupportedAudioTypes: []string{"audio/mpeg"}})
+	if !errors.Is(err, ErrUnsupportedAudioType) {
+		t.Errorf("Expected ErrUnsupportedAudioType, got %v", err)
+	}
+
+	// Providers without audio support reject the block explicitly.
+	_, _, err = Negotiate([]ContentBlock{block}, Capabilities{}, NegotiationPolicy{})
+	var unsupported *UnsupportedContentError
+	if !errors.As(err, &unsupported) || unsupported.Type != ContentTypeAudio {
+		t.Errorf("Expected audio to be rejected, got %v", err)
+	}
+	_, _, err = Negotiate([]ContentBlock{block}, Capabilities{SupportsAudio: true, MaxAudioSize: 1000}, NegotiationPolicy{})
+	if !errors.As(err, &unsupported) || !strings.Contains(unsupported.Reason, "exceeds limit of 1000") {
+		t.Errorf("Expected oversized audio to be rejected, got %v", err)
+	}
+
+	if got := CountContentTokens([]ContentBlock{block}, estimateTextTokens); got != 64 {
+		t.Errorf("Expected 64 tokens for 2s of audio, got %d", got)
+	}
+}
@@ -0,0 +1,196 @@
+package llmapi
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Fork creates a new conversation from factory holding conv's system
+// prompt, tools, settings and first atIndex messages. conv itself is
+// unchanged. Conversations do not expose their settings, so the caller
+// supplies them as for NewSnapshot; they are applied as in
+// Snapshot.Restore. atIndex may range from 0 (empty history) to
+// len(conv.GetRichMessages()).
+func Fork(conv Conversation, atIndex int, factory ConversationFactory, settings Settings) (Conversation, error) {
+	snap := NewSnapshot(conv, settings)
+	if atIndex < 0 || atIndex > len(snap.Messages) {
+		return nil, fmt.Errorf("fork index %d out of range [0, %d]", atIndex, len(snap.Messages))
+	}
+	snap.Messages = snap.Messages[:atIndex]
+	return snap.Restore(factory), nil
+}
+
+// ==========================================================================
+// Conversation Trees
+// ==========================================================================
+
+// TreeNode is a message in a ConversationTree. Children are alternative
+// continuations of the conversation after this message, in creation order.
+type TreeNode struct {
+	Message  RichMessage
+	Parent   *TreeNode
+	Children []*TreeNode
+}
+
+// Depth returns the node's index in its conversation path (0 for the
+// first message, -1 for the tree's root).
+func (n *TreeNode) Depth() int {
+	d := -1
+	for p := n.Parent; p != nil; p = p.Parent {
+		d++
+	}
+	return d
+}
+
+// Siblings returns the alternatives to this node, including itself.
+func (n *TreeNode) Siblings() []*TreeNode {
+	if n.Parent == nil {
+		return []*TreeNode{n}
+	}
+	return n.Parent.Children
+}
+
+// ConversationTree records every branch of a conversation, for
+// "regenerate" and tree-of-thought interfaces. One path through the tree,
+// ending at the active node, is the active branch.
+type ConversationTree struct {
+	System   string
+	Tools    []ToolDefinition
+	Settings Settings
+
+	root   *TreeNode // sentinel; holds no message
+	active *TreeNode
+}
+
+// NewConversationTree creates a tree whose active branch is conv's
+// current history. settings are conv's settings, supplied as for
+// NewSnapshot, and are applied to replayed conversations.
+func NewConversationTree(conv Conversation, settings Settings) *ConversationTree {
+	t := &ConversationTree{
+		System:   conv.GetSystem(),
+		Tools:    conv.GetTools(),
+		Settings: settings,
+		root:     &TreeNode{},
+	}
+	t.active = t.root
+	for _, msg := range conv.GetRichMessages() {
+		t.Append(msg)
+	}
+	return t
+}
+
+// Root returns the first messages of every branch.
+func (t *ConversationTree) Root() []*TreeNode {
+	return t.root.Children
+}
+
+// Active returns the last node of the active branch, or nil if it is empty.
+func (t *ConversationTree) Active() *TreeNode {
+	if t.active == t.root {
+		return nil
+	}
+	return t.active
+}
+
+// ActivePath returns the nodes of the active branch, in order.
+func (t *ConversationTree) ActivePath() []*TreeNode {
+	var path []*TreeNode
+	for n := t.active; n != t.root; n = n.Parent {
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// ActiveMessages returns the messages of the active branch.
+func (t *ConversationTree) ActiveMessages() []RichMessage {
+	path := t.ActivePath()
+	msgs := make([]RichMessage, len(path))
+	for i, n := range path {
+		msgs[i] = n.Message
+	}
+	return msgs
+}
+
+// Append adds msg as a new child of the active node and makes it active.
+func (t *ConversationTree) Append(msg RichMessage) *TreeNode {
+	n := &TreeNode{Message: msg, Parent: t.active}
+	t.active.Children = append(t.active.Children, n)
+	t.active = n
+	return n
+}
+
+// Fork moves the active node back so the active branch holds its first
+// atIndex messages. The discarded messages stay in the tree; the next
+// Append creates a sibling alternative to the message at atIndex.
+func (t *ConversationTree) Fork(atIndex int) error {
+	path := t.ActivePath()
+	if atIndex < 0 || atIndex > len(path) {
+		return fmt.Errorf("fork index %d out of range [0, %d]", atIndex, len(path))
+	}
+	if atIndex == 0 {
+		t.active = t.root
+	} else {
+		t.active = path[atIndex-1]
+	}
+	return nil
+}
+
+// Switch makes the branch through node active. The active branch then
+// continues from node along the most recently created children.
+func (t *ConversationTree) Switch(node *TreeNode) error {
+	if !t.contains(node) {
+		return fmt.Errorf("node is not in this tree")
+	}
+	for len(node.Children) > 0 {
+		node = node.Children[len(node.Children)-1]
+	}
+	t.active = node
+	return nil
+}
+
+func (t *ConversationTree) contains(node *TreeNode) bool {
+	if node == nil {
+		return false
+	}
+	for node.Parent != nil {
+		node = node.Parent
+	}
+	return node == t.root
+}
+
+// Record appends the messages conv has beyond the active branch, so that
+// turns taken on a replayed conversation are added to the tree. It
+// returns an error if conv's history has diverged from the active branch.
+func (t *ConversationTree) Record(conv Conversation) error {
+	active := t.ActiveMessages()
+	msgs := conv.GetRichMessages()
+	if len(msgs) < len(active) {
+		return fmt.Errorf("conversation has %d messages, active branch has %d", len(msgs), len(active))
+	}
+	for i := range active {
+		if !reflect.DeepEqual(active[i], msgs[i]) {
+			return fmt.Errorf("conversation diverges from active branch at message %d", i)
+		}
+	}
+	for _, msg := range msgs[len(active):] {
+		t.Append(msg)
+	}
+	return nil
+}
+
+// Replay creates a new conversation from factory holding the tree's
+// system prompt, tools and active branch, with its settings applied as in
+// Snapshot.Restore.
+func (t *ConversationTree) Replay(factory ConversationFactory) Conversation {
+	snap := &Snapshot{
+		Version:  SnapshotVersion,
+		System:   t.System,
+		Settings: t.Settings,
+		Tools:    t.Tools,
+		Messages: t.ActiveMessages(),
+	}
+	return snap.Restore(factory)
+}
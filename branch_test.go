@@ -0,0 +1,78 @@
+package llmapi
+
+import "testing"
+
+// TestFork tests forking a conversation at a message index.
+func TestFork(t *testing.T) {
+	conv := newMockConversation("sys")
+	conv.Send("one", Sampling{})
+	conv.Send("two", Sampling{})
+
+	fork, err := Fork(conv, 2, mockFactory{}, Settings{Model: "moved-model", MaxTokens: 512, ToolChoice: NewToolChoice(ToolChoiceNone)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := len(fork.GetRichMessages()); n != 2 {
+		t.Errorf("Expected 2 messages in fork, got %d", n)
+	}
+	if fork.GetSystem() != "sys" {
+		t.Errorf("Expected system prompt to be copied")
+	}
+	if m := fork.(*mockConversation); m.model != "moved-model" || m.maxTokens != 512 || m.toolChoice == nil {
+		t.Errorf("Expected settings to be carried over, got model %q, max tokens %d, tool choice %v",
+			m.model, m.maxTokens, m.toolChoice)
+	}
+	if n := len(conv.GetRichMessages()); n != 4 {
+		t.Errorf("Expected original to be unchanged, got %d messages", n)
+	}
+	if _, err := Fork(conv, 5, mockFactory{}, Settings{}); err == nil {
+		t.Error("Expected error for out-of-range index")
+	}
+}
+
+// TestConversationTree tests regenerating, switching branches and replay.
+func TestConversationTree(t *testing.T) {
+	conv := newMockConversation("sys")
+	conv.Send("question", Sampling{})
+	tree := NewConversationTree(conv, Settings{Model: "tree-model", MaxTokens: 256, ToolChoice: NewToolChoice(ToolChoiceNone)})
+	first := tree.Active()
+
+	// Regenerate the assistant reply.
+	if err := tree.Fork(1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	regen := tree.Replay(mockFactory{}).(*mockConversation)
+	if regen.model != "tree-model" || regen.maxTokens != 256 || regen.toolChoice == nil {
+		t.Errorf("Expected settings to be applied on replay, got model %q, max tokens %d, tool choice %v",
+			regen.model, regen.maxTokens, regen.toolChoice)
+	}
+	regen.replies = []*RichResponse{{Content: textContent("alternative"), StopReason: "end_turn"}}
+	regen.SendRich(nil, Sampling{})
+	if err := tree.Record(regen); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second := tree.Active()
+	if second.Depth() != 1 || len(second.Siblings()) != 2 {
+		t.Fatalf("Expected two sibling replies at depth 1, got %d at depth %d", len(second.Siblings()), second.Depth())
+	}
+	if got := second.Message.ToMessage().Content; got != "alternative" {
+		t.Errorf("Expected active reply 'alternative', got '%s'", got)
+	}
+
+	if err := tree.Switch(first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	replayed := tree.Replay(mockFactory{})
+	msgs := replayed.GetMessages()
+	if len(msgs) != 2 || msgs[1].Content != "echo: question" {
+		t.Errorf("Expected original branch to be replayed, got %+v", msgs)
+	}
+
+	if err := tree.Record(conv); err != nil {
+		t.Errorf("Expected matching conversation to record cleanly: %v", err)
+	}
+	if err := tree.Switch(&TreeNode{}); err == nil {
+		t.Error("Expected error switching to a foreign node")
+	}
+}
@@ -0,0 +1,319 @@
+package llmapi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxTokensSetter is optionally implemented by Conversation implementations
+// that allow the output token limit to be changed between calls.
+type MaxTokensSetter interface {
+	// SetMaxTokens sets Settings.MaxTokens for subsequent calls.
+	SetMaxTokens(maxTokens int)
+}
+
+// ==========================================================================
+// Budgets
+// ==========================================================================
+
+// BudgetExceededError is returned when a call would take a budget over
+// its token or cost limit.
+type BudgetExceededError struct {
+	// Budget is the name of the budget that would be exceeded.
+	Budget string
+	// Kind is "tokens" or "cost".
+	Kind string
+	// Limit is the budget's limit, in tokens or USD.
+	Limit float64
+	// Used is the amount already consumed.
+	Used float64
+	// Requested is the estimated amount the call needed.
+	Requested float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget %q exceeded: %s limit %g, used %g, call needs %g",
+		e.Budget, e.Kind, e.Limit, e.Used, e.Requested)
+}
+
+// Budget is a token and/or spend limit. A Budget may be private to one
+// conversation or shared as a pool across many; it is safe for concurrent
+// use. Checks are made against estimates before each call, so concurrent
+// calls sharing a pool can overshoot it by at most their combined estimates.
+type Budget struct {
+	name      string
+	maxTokens int
+	maxCost   float64
+	pricing   *PricingTable
+
+	mu     sync.Mutex
+	tokens int
+	cost   float64
+}
+
+// NewBudget creates a budget. maxTokens limits input plus output tokens and
+// maxCost limits spend in USD; zero means unlimited. pricing is required
+// for a cost limit to take effect.
+func NewBudget(name string, maxTokens int, maxCost float64, pricing *PricingTable) *Budget {
+	return &Budget{
+		name:      name,
+		maxTokens: maxTokens,
+		maxCost:   maxCost,
+		pricing:   pricing,
+	}
+}
+
+// Used returns the tokens and USD consumed so far.
+func (b *Budget) Used() (tokens int, cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens, b.cost
+}
+
+// allowedOutput returns how many output tokens a call with the given
+// estimated input may generate without exceeding the budget, capped at
+// maxOutput, and which limit ("tokens" or "cost") is binding if the cap
+// was lowered. It returns an error if even the input does not fit.
+func (b *Budget) allowedOutput(model string, inputTokens, maxOutput int) (int, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	allowed, binding := maxOutput, ""
+	if b.maxTokens > 0 {
+		remaining := b.maxTokens - b.tokens - inputTokens
+		if remaining <= 0 {
+			return 0, "tokens", b.exceeded("tokens", model, inputTokens, 1)
+		}
+		if remaining < allowed {
+			allowed, binding = remaining, "tokens"
+		}
+	}
+
+	if b.maxCost > 0 && b.pricing != nil {
+		if p, ok := b.pricing.Lookup(model); ok {
+			remaining := b.maxCost - b.cost - p.Cost(Usage{InputTokens: inputTokens}).Total()
+			outputPerToken := p.Output / 1_000_000
+			if remaining <= 0 || remaining < outputPerToken {
+				return 0, "cost", b.exceeded("cost", model, inputTokens, 1)
+			}
+			if outputPerToken > 0 && int(remaining/outputPerToken) < allowed {
+				allowed, binding = int(remaining/outputPerToken), "cost"
+			}
+		}
+	}
+	return allowed, binding, nil
+}
+
+// exceeded builds the error for a call of the given size. The caller must
+// hold b.mu.
+func (b *Budget) exceeded(kind, model string, inputTokens, outputTokens int) *BudgetExceededError {
+	err := &BudgetExceededError{Budget: b.name, Kind: kind}
+	if kind == "cost" {
+		p, _ := b.pricing.Lookup(model)
+		err.Limit = b.maxCost
+		err.Used = b.cost
+		err.Requested = p.Cost(Usage{InputTokens: inputTokens, OutputTokens: outputTokens}).Total()
+	} else {
+		err.Limit = float64(b.maxTokens)
+		err.Used = float64(b.tokens)
+		err.Requested = float64(inputTokens + outputTokens)
+	}
+	return err
+}
+
+// record adds the actual usage of a completed call. Cached input tokens
+// count towards spend but not towards the token limit.
+func (b *Budget) record(model string, usage Usage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += usage.InputTokens + usage.OutputTokens
+	if b.pricing != nil {
+		if p, ok := b.pricing.Lookup(model); ok {
+			b.cost += p.Cost(usage).Total()
+		}
+	}
+}
+
+// ==========================================================================
+// Budget Decorator
+// ==========================================================================
+
+// BudgetConversation wraps a Conversation and enforces one or more budgets.
+//
+// Before each call the input is estimated and checked against every budget.
+// If the remaining budget cannot cover Settings.MaxTokens of output, the
+// output limit is lowered for that call through MaxTokensSetter; if the
+// wrapped conversation does not implement it, or fewer than MinOutputTokens
+// remain, the call is rejected with a *BudgetExceededError. The lowered
+// limit is restored after the call only if the conversation's MaxTokens is
+// known, from Settings or SetMaxTokens; otherwise it stays in effect.
+type BudgetConversation struct {
+	Conversation
+	budgets   []*Budget
+	model     string
+	maxTokens int
+
+	// MinOutputTokens is the smallest output limit a call may be lowered
+	// to before it is rejected instead. Defaults to 1.
+	MinOutputTokens int
+}
+
+// WithBudget wraps conv so that every call is checked against budgets.
+// settings supplies the conversation's model and MaxTokens.
+func WithBudget(conv Conversation, settings Settings, budgets ...*Budget) *BudgetConversation {
+	return &BudgetConversation{
+		Conversation:    conv,
+		budgets:         budgets,
+		model:           settings.Model,
+		maxTokens:       settings.MaxTokens,
+		MinOutputTokens: 1,
+	}
+}
+
+// SetModel changes the model used for subsequent calls and pricing.
+func (bc *BudgetConversation) SetModel(model string) {
+	bc.model = model
+	bc.Conversation.SetModel(model)
+}
+
+// SetMaxTokens changes the output limit checked against the budgets, and
+// forwards it to the wrapped conversation if supported.
+func (bc *BudgetConversation) SetMaxTokens(maxTokens int) {
+	bc.maxTokens = maxTokens
+	if s, ok := bc.Conversation.(MaxTokensSetter); ok {
+		s.SetMaxTokens(maxTokens)
+	}
+}
+
+// reserve checks content against the budgets, lowering the output limit
+// if needed. The returned function restores a known limit and must be
+// called once the call completes.
+func (bc *BudgetConversation) reserve(content []ContentBlock) (func(), error) {
+	input := estimateInputTokens(bc.Conversation, content)
+	requested := bc.maxTokens
+	if requested <= 0 {
+		requested = DefaultSettings.MaxTokens
+	}
+
+	allowed, kind := requested, ""
+	var binding *Budget
+	for _, b := range bc.budgets {
+		n, k, err := b.allowedOutput(bc.model, input, allowed)
+		if err != nil {
+			return nil, err
+		}
+		if n < allowed {
+			allowed, kind, binding = n, k, b
+		}
+	}
+	if binding == nil {
+		return func() {}, nil
+	}
+
+	setter, ok := bc.Conversation.(MaxTokensSetter)
+	if !ok || allowed < bc.MinOutputTokens {
+		binding.mu.Lock()
+		defer binding.mu.Unlock()
+		return nil, binding.exceeded(kind, bc.model, input, requested)
+	}
+	setter.SetMaxTokens(allowed)
+	if bc.maxTokens <= 0 {
+		// The wrapped conversation's own limit is unknown, so there is
+		// nothing to restore it to.
+		return func() {}, nil
+	}
+	return func() { setter.SetMaxTokens(bc.maxTokens) }, nil
+}
+
+func (bc *BudgetConversation) record(usage Usage) {
+	for _, b := range bc.budgets {
+		b.record(bc.model, usage)
+	}
+}
+
+func (bc *BudgetConversation) sendText(text string, send func(string) (string, string, int, int, error)) (string, string, int, int, error) {
+	restore, err := bc.reserve(textContent(text))
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	defer restore()
+	reply, stopReason, in, out, err := send(text)
+	bc.record(Usage{InputTokens: in, OutputTokens: out})
+	return reply, stopReason, in, out, err
+}
+
+func (bc *BudgetConversation) sendRich(content []ContentBlock, send func() (*RichResponse, error)) (*RichResponse, error) {
+	restore, err := bc.reserve(content)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	resp, err := send()
+	if resp != nil {
+		bc.record(resp.Usage())
+	}
+	return resp, err
+}
+
+// Send checks the budgets, then forwards to the wrapped conversation.
+func (bc *BudgetConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	return bc.sendText(text, func(text string) (string, string, int, int, error) {
+		return bc.Conversation.Send(text, sampling)
+	})
+}
+
+// SendStreaming checks the budgets, then forwards to the wrapped conversation.
+func (bc *BudgetConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return bc.sendText(text, func(text string) (string, string, int, int, error) {
+		return bc.Conversation.SendStreaming(text, sampling, callback)
+	})
+}
+
+// SendUntilDone calls Send until the stop reason is not "max_tokens",
+// checking the budgets before each continuation.
+func (bc *BudgetConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	return untilDone(text, func(text string) (string, string, int, int, error) {
+		return bc.Send(text, sampling)
+	})
+}
+
+// SendStreamingUntilDone calls SendStreaming until the stop reason is not
+// "max_tokens", checking the budgets before each continuation.
+func (bc *BudgetConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return untilDone(text, func(text string) (string, string, int, int, error) {
+		return bc.SendStreaming(text, sampling, callback)
+	})
+}
+
+// untilDone repeatedly calls send until the stop reason is not
+// "max_tokens", passing an empty text for continuations. It returns the
+// accumulated reply and token counts.
+func untilDone(text string, send func(text string) (string, string, int, int, error)) (
+	reply, stopReason string, inputTokens, outputTokens int, err error) {
+	for {
+		var part string
+		var in, out int
+		part, stopReason, in, out, err = send(text)
+		reply += part
+		inputTokens += in
+		outputTokens += out
+		if err != nil || stopReason != "max_tokens" {
+			return
+		}
+		text = ""
+	}
+}
+
+// SendRich checks the budgets, then forwards to the wrapped conversation.
+func (bc *BudgetConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	return bc.sendRich(content, func() (*RichResponse, error) {
+		return bc.Conversation.SendRich(content, sampling)
+	})
+}
+
+// SendRichStreaming checks the budgets, then forwards to the wrapped conversation.
+func (bc *BudgetConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	return bc.sendRich(content, func() (*RichResponse, error) {
+		return bc.Conversation.SendRichStreaming(content, sampling, callback)
+	})
+}
@@ -0,0 +1,82 @@
+package llmapi
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestBudgetConversation tests token budget checks, output truncation and
+// shared pools.
+func TestBudgetConversation(t *testing.T) {
+	t.Run("LowersMaxTokens", func(t *testing.T) {
+		mock := newMockConversation("")
+		budget := NewBudget("conv", 100, 0, nil)
+		conv := WithBudget(mock, Settings{Model: "mock-model", MaxTokens: 1000}, budget)
+		mock.maxTokens = 1000
+
+		if _, _, _, _, err := conv.Send("hello", Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// "hello" estimates to 2 tokens, leaving 98 for output.
+		if mock.lastMaxTokens != 98 {
+			t.Errorf("Expected MaxTokens lowered to 98, got %d", mock.lastMaxTokens)
+		}
+		if mock.maxTokens != 1000 {
+			t.Errorf("Expected MaxTokens restored to 1000, got %d", mock.maxTokens)
+		}
+		if used, _ := budget.Used(); used != 4 {
+			t.Errorf("Expected 4 tokens used, got %d", used)
+		}
+	})
+
+	t.Run("UnknownMaxTokensNotRestored", func(t *testing.T) {
+		mock := newMockConversation("")
+		conv := WithBudget(mock, Settings{}, NewBudget("conv", 100, 0, nil))
+
+		if _, _, _, _, err := conv.Send("hello", Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if mock.maxTokens != 98 {
+			t.Errorf("Expected the lowered MaxTokens to stay at 98, got %d", mock.maxTokens)
+		}
+
+		conv.SetMaxTokens(500)
+		if _, _, _, _, err := conv.Send("hello", Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if mock.maxTokens != 500 {
+			t.Errorf("Expected MaxTokens restored to 500, got %d", mock.maxTokens)
+		}
+	})
+
+	t.Run("SharedPoolExceeded", func(t *testing.T) {
+		pool := NewBudget("pool", 10, 0, nil)
+		a := WithBudget(newMockConversation(""), Settings{MaxTokens: 5}, pool)
+		b := WithBudget(newMockConversation(""), Settings{MaxTokens: 5}, pool)
+
+		if _, _, _, _, err := a.Send("one two three four", Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err := b.SendRich(textContent("one two three four five six seven eight"), Sampling{})
+		var budgetErr *BudgetExceededError
+		if !errors.As(err, &budgetErr) {
+			t.Fatalf("Expected BudgetExceededError, got %v", err)
+		}
+		if budgetErr.Budget != "pool" || budgetErr.Kind != "tokens" || budgetErr.Used != 10 {
+			t.Errorf("Unexpected error details: %+v", budgetErr)
+		}
+	})
+
+	t.Run("CostLimit", func(t *testing.T) {
+		pricing := NewPricingTable()
+		pricing.Set("m", ModelPricing{Input: 1_000_000, Output: 1_000_000}) // $1 per token
+		budget := NewBudget("dollars", 0, 3, pricing)
+		conv := WithBudget(newMockConversation(""), Settings{Model: "m", MaxTokens: 100}, budget)
+
+		_, err := conv.SendRich(textContent("a long enough message to cost more"), Sampling{})
+		var budgetErr *BudgetExceededError
+		if !errors.As(err, &budgetErr) || budgetErr.Kind != "cost" {
+			t.Fatalf("Expected cost BudgetExceededError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,443 @@
+package llmapi
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ==========================================================================
+// Cache Stores
+// ==========================================================================
+
+// CachedResponse is a response stored by a CachingConversation.
+type CachedResponse struct {
+	// Response is the full response as returned by the provider.
+	Response RichResponse `json:"response"`
+	// Chunks are the streamed text fragments, in order, if the response was
+	// recorded from a streaming call. Used to replay through StreamCallback.
+	Chunks []string `json:"chunks,omitempty"`
+	// Messages are the messages the call added to the conversation's
+	// history, replayed on a hit. Auto-continued calls add several
+	// assistant turns. If empty, the request and Response are replayed.
+	Messages []RichMessage `json:"messages,omitempty"`
+	// ExpiresAt is when the entry stops being served. Zero = never.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+func (cr *CachedResponse) expired(now time.Time) bool {
+	return !cr.ExpiresAt.IsZero() && now.After(cr.ExpiresAt)
+}
+
+// CacheStore persists cached responses by key.
+type CacheStore interface {
+	// Get returns the entry for key. ok is false if there is no entry or
+	// it has expired.
+	Get(key string) (entry *CachedResponse, ok bool, err error)
+	// Put stores an entry, replacing any existing one.
+	Put(key string, entry *CachedResponse) error
+}
+
+// MemoryCache is an in-memory CacheStore that evicts the least recently
+// used entry once it holds capacity entries. It is safe for concurrent use.
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	entries  map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+// NewMemoryCache creates an LRU cache. capacity <= 0 means unbounded.
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheStore.
+func (mc *MemoryCache) Get(key string) (*CachedResponse, bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	el, ok := mc.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := el.Value.(*memoryCacheItem)
+	if item.entry.expired(time.Now()) {
+		mc.order.Remove(el)
+		delete(mc.entries, key)
+		return nil, false, nil
+	}
+	mc.order.MoveToFront(el)
+	return item.entry, true, nil
+}
+
+// Put implements CacheStore.
+func (mc *MemoryCache) Put(key string, entry *CachedResponse) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if el, ok := mc.entries[key]; ok {
+		el.Value.(*memoryCacheItem).entry = entry
+		mc.order.MoveToFront(el)
+		return nil
+	}
+	mc.entries[key] = mc.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if mc.capacity > 0 && mc.order.Len() > mc.capacity {
+		oldest := mc.order.Back()
+		mc.order.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache.
+func (mc *MemoryCache) Len() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.order.Len()
+}
+
+// DiskCache is a CacheStore that keeps one JSON file per entry in a
+// directory.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a disk cache in dir, creating it if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (dc *DiskCache) path(key string) string {
+	return filepath.Join(dc.dir, key+".json")
+}
+
+// Get implements CacheStore. Expired entries are removed.
+func (dc *DiskCache) Get(key string) (*CachedResponse, bool, error) {
+	data, err := os.ReadFile(dc.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry CachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	if entry.expired(time.Now()) {
+		os.Remove(dc.path(key))
+		return nil, false, nil
+	}
+	return &entry, true, nil
+}
+
+// Put implements CacheStore. The entry is written to a temporary file and
+// renamed into place so readers never see a partial entry.
+func (dc *DiskCache) Put(key string, entry *CachedResponse) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dc.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dc.path(key))
+}
+
+// ==========================================================================
+// Caching Decorator
+// ==========================================================================
+
+// CachingConversation wraps a Conversation and serves repeated requests
+// from a CacheStore.
+//
+// Requests are keyed by a hash of the system prompt, rich history, tools,
+// settings (including model), sampling and new content, so a hit requires
+// the entire conversation state to match. On a hit the request and cached
+// reply are appended to the wrapped conversation's history without calling
+// the provider, and streaming callbacks receive the cached text in the
+// chunks originally streamed. Cached responses report the token counts of
+// the original call.
+//
+// Store errors are treated as misses and never fail a call.
+type CachingConversation struct {
+	Conversation
+	store    CacheStore
+	settings Settings
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+// WithCache wraps conv with a response cache. settings should describe the
+// conversation's configuration; its Model is updated by SetModel. ttl is
+// how long entries remain valid; 0 means forever.
+func WithCache(conv Conversation, store CacheStore, settings Settings, ttl time.Duration) *CachingConversation {
+	return &CachingConversation{
+		Conversation: conv,
+		store:        store,
+		settings:     settings,
+		ttl:          ttl,
+	}
+}
+
+// SetModel changes the model for subsequent calls and cache keys.
+func (cc *CachingConversation) SetModel(model string) {
+	cc.settings.Model = model
+	cc.Conversation.SetModel(model)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (cc *CachingConversation) Stats() (hits, misses int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.hits, cc.misses
+}
+
+// cacheKeyInput is everything that determines a response.
+type cacheKeyInput struct {
+	Mode     string           `json:"mode"`
+	System   string           `json:"system"`
+	History  []RichMessage    `json:"history"`
+	Tools    []ToolDefinition `json:"tools"`
+	Settings Settings         `json:"settings"`
+	Sampling Sampling         `json:"sampling"`
+	Content  []ContentBlock   `json:"content"`
+}
+
+// Cache key modes. Text and rich calls are keyed apart, since a text call
+// only records the reply text, and auto-continued calls differ from
+// single ones.
+const (
+	cacheModeText          = "text"
+	cacheModeTextUntilDone = "text_until_done"
+	cacheModeRich          = "rich"
+)
+
+// key returns a stable hash of the request in the given mode.
+func (cc *CachingConversation) key(mode string, content []ContentBlock, sampling Sampling) string {
+	data, err := json.Marshal(cacheKeyInput{
+		Mode:     mode,
+		System:   cc.GetSystem(),
+		History:  cc.GetRichMessages(),
+		Tools:    cc.GetTools(),
+		Settings: cc.settings,
+		Sampling: sampling,
+		Content:  content,
+	})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached entry for key, counting the hit or miss.
+func (cc *CachingConversation) lookup(key string) (*CachedResponse, bool) {
+	var entry *CachedResponse
+	ok := false
+	if key != "" {
+		var err error
+		entry, ok, err = cc.store.Get(key)
+		ok = ok && err == nil
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if ok {
+		cc.hits++
+	} else {
+		cc.misses++
+	}
+	return entry, ok
+}
+
+// save caches resp, along with the messages added to the history since it
+// held before messages.
+func (cc *CachingConversation) save(key string, resp *RichResponse, chunks []string, before int) {
+	if key == "" || resp == nil {
+		return
+	}
+	entry := &CachedResponse{Response: *resp, Chunks: chunks}
+	if msgs := cc.GetRichMessages(); len(msgs) > before {
+		entry.Messages = msgs[before:]
+	}
+	if cc.ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(cc.ttl)
+	}
+	cc.store.Put(key, entry)
+}
+
+// replay appends a cached exchange to the wrapped conversation's history
+// and streams its text to callback.
+func (cc *CachingConversation) replay(content []ContentBlock, entry *CachedResponse, callback StreamCallback) *RichResponse {
+	if len(entry.Messages) > 0 {
+		replayHistory(cc.Conversation, entry.Messages)
+	} else {
+		if len(content) > 0 {
+			cc.AddRichMessage(RoleUser, content)
+		}
+		cc.AddRichMessage(RoleAssistant, entry.Response.Content)
+	}
+
+	if callback != nil {
+		chunks := entry.Chunks
+		if chunks == nil {
+			chunks = splitChunks(entry.Response.Text())
+		}
+		for _, chunk := range chunks {
+			callback(chunk, false)
+		}
+		callback("", true)
+	}
+	resp := entry.Response
+	return &resp
+}
+
+// recordChunks wraps callback to capture the streamed text fragments.
+func recordChunks(callback StreamCallback, chunks *[]string) StreamCallback {
+	return func(text string, done bool) {
+		if text != "" {
+			*chunks = append(*chunks, text)
+		}
+		if callback != nil {
+			callback(text, done)
+		}
+	}
+}
+
+// splitChunks splits text into word-sized fragments, each carrying its
+// trailing whitespace, approximating how providers stream tokens.
+func splitChunks(text string) []string {
+	var chunks []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if inSpace && !space {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+func (cc *CachingConversation) sendText(mode, text string, sampling Sampling, callback StreamCallback,
+	send func(StreamCallback) (string, string, int, int, error)) (string, string, int, int, error) {
+	content := textContent(text)
+	key := cc.key(mode, content, sampling)
+	if entry, ok := cc.lookup(key); ok {
+		resp := cc.replay(content, entry, callback)
+		return resp.Text(), resp.StopReason, resp.InputTokens, resp.OutputTokens, nil
+	}
+
+	var chunks []string
+	if callback != nil {
+		callback = recordChunks(callback, &chunks)
+	}
+	before := len(cc.GetRichMessages())
+	reply, stopReason, in, out, err := send(callback)
+	if err == nil {
+		cc.save(key, &RichResponse{
+			Content:      textContent(reply),
+			StopReason:   stopReason,
+			InputTokens:  in,
+			OutputTokens: out,
+		}, chunks, before)
+	}
+	return reply, stopReason, in, out, err
+}
+
+func (cc *CachingConversation) sendRich(content []ContentBlock, sampling Sampling, callback StreamCallback,
+	send func(StreamCallback) (*RichResponse, error)) (*RichResponse, error) {
+	key := cc.key(cacheModeRich, content, sampling)
+	if entry, ok := cc.lookup(key); ok {
+		return cc.replay(content, entry, callback), nil
+	}
+
+	var chunks []string
+	if callback != nil {
+		callback = recordChunks(callback, &chunks)
+	}
+	before := len(cc.GetRichMessages())
+	resp, err := send(callback)
+	if err == nil {
+		cc.save(key, resp, chunks, before)
+	}
+	return resp, err
+}
+
+// Send returns a cached reply if available, otherwise forwards and caches.
+func (cc *CachingConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	return cc.sendText(cacheModeText, text, sampling, nil, func(StreamCallback) (string, string, int, int, error) {
+		return cc.Conversation.Send(text, sampling)
+	})
+}
+
+// SendStreaming returns a cached reply if available, otherwise forwards and caches.
+func (cc *CachingConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return cc.sendText(cacheModeText, text, sampling, callback, func(cb StreamCallback) (string, string, int, int, error) {
+		return cc.Conversation.SendStreaming(text, sampling, cb)
+	})
+}
+
+// SendUntilDone returns a cached reply if available, otherwise forwards and caches.
+func (cc *CachingConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	return cc.sendText(cacheModeTextUntilDone, text, sampling, nil, func(StreamCallback) (string, string, int, int, error) {
+		return cc.Conversation.SendUntilDone(text, sampling)
+	})
+}
+
+// SendStreamingUntilDone returns a cached reply if available, otherwise forwards and caches.
+func (cc *CachingConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return cc.sendText(cacheModeTextUntilDone, text, sampling, callback, func(cb StreamCallback) (string, string, int, int, error) {
+		return cc.Conversation.SendStreamingUntilDone(text, sampling, cb)
+	})
+}
+
+// SendRich returns a cached response if available, otherwise forwards and caches.
+func (cc *CachingConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	return cc.sendRich(content, sampling, nil, func(StreamCallback) (*RichResponse, error) {
+		return cc.Conversation.SendRich(content, sampling)
+	})
+}
+
+// SendRichStreaming returns a cached response if available, otherwise forwards and caches.
+func (cc *CachingConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	return cc.sendRich(content, sampling, callback, func(cb StreamCallback) (*RichResponse, error) {
+		return cc.Conversation.SendRichStreaming(content, sampling, cb)
+	})
+}
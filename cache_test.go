@@ -0,0 +1,156 @@
+package llmapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCachingConversation tests cache hits, misses and streaming replay.
+func TestCachingConversation(t *testing.T) {
+	store := NewMemoryCache(10)
+	settings := Settings{Model: "mock-model", MaxTokens: 100}
+
+	first := newMockConversation("system")
+	conv := WithCache(first, store, settings, 0)
+	var streamed []string
+	reply, _, _, _, err := conv.SendStreaming("hello world", Sampling{}, func(text string, done bool) {
+		if !done {
+			streamed = append(streamed, text)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second := newMockConversation("system")
+	cached := WithCache(second, store, settings, 0)
+	var replayed []string
+	gotDone := false
+	reply2, _, _, _, err := cached.SendStreaming("hello world", Sampling{}, func(text string, done bool) {
+		if done {
+			gotDone = true
+			return
+		}
+		replayed = append(replayed, text)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if second.calls != 0 {
+		t.Errorf("Expected cache hit to skip the provider, got %d calls", second.calls)
+	}
+	if reply2 != reply {
+		t.Errorf("Expected cached reply '%s', got '%s'", reply, reply2)
+	}
+	if !reflect.DeepEqual(replayed, streamed) || !gotDone {
+		t.Errorf("Expected replayed chunks %q, got %q (done=%t)", streamed, replayed, gotDone)
+	}
+	if msgs := second.GetRichMessages(); len(msgs) != 2 {
+		t.Errorf("Expected replayed exchange in history, got %d messages", len(msgs))
+	}
+	if hits, misses := cached.Stats(); hits != 1 || misses != 0 {
+		t.Errorf("Expected 1 hit and 0 misses, got %d and %d", hits, misses)
+	}
+
+	// Different sampling must miss.
+	third := WithCache(newMockConversation("system"), store, settings, 0)
+	third.Send("hello world", Sampling{Temperature: 0.5})
+	if hits, misses := third.Stats(); hits != 0 || misses != 1 {
+		t.Errorf("Expected a miss for different sampling, got %d hits %d misses", hits, misses)
+	}
+}
+
+// TestCacheModes tests that text and rich calls are keyed apart and that
+// auto-continued calls replay every turn they added.
+func TestCacheModes(t *testing.T) {
+	store := NewMemoryCache(10)
+	settings := Settings{Model: "mock-model"}
+
+	WithCache(newMockConversation("system"), store, settings, 0).Send("hi", Sampling{})
+	mock := newMockConversation("system")
+	mock.replies = []*RichResponse{{Content: []ContentBlock{NewThinkingBlock("hmm"), NewTextBlock("hello")}, StopReason: "end_turn"}}
+	rich := WithCache(mock, store, settings, 0)
+	resp, err := rich.SendRich(textContent("hi"), Sampling{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mock.calls != 1 || len(resp.Content) != 2 {
+		t.Errorf("Expected a rich call to miss a text entry, got %d calls and %+v", mock.calls, resp.Content)
+	}
+
+	first := newMockConversation("system")
+	first.replies = []*RichResponse{
+		{Content: textContent("part one "), StopReason: "max_tokens"},
+		{Content: textContent("part two"), StopReason: "end_turn"},
+	}
+	WithCache(first, store, settings, 0).SendUntilDone("long", Sampling{})
+
+	second := newMockConversation("system")
+	reply, _, _, _, err := WithCache(second, store, settings, 0).SendUntilDone("long", Sampling{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if second.calls != 0 || reply != "part one part two" {
+		t.Errorf("Expected a cached reply, got %q after %d calls", reply, second.calls)
+	}
+	if !reflect.DeepEqual(second.GetRichMessages(), first.GetRichMessages()) {
+		t.Errorf("Expected every continuation turn replayed, got %d messages, want %d",
+			len(second.GetRichMessages()), len(first.GetRichMessages()))
+	}
+}
+
+// TestMemoryCacheEviction tests LRU eviction and TTL expiry.
+func TestMemoryCacheEviction(t *testing.T) {
+	mc := NewMemoryCache(2)
+	mc.Put("a", &CachedResponse{})
+	mc.Put("b", &CachedResponse{})
+	mc.Get("a")
+	mc.Put("c", &CachedResponse{})
+
+	if _, ok, _ := mc.Get("b"); ok {
+		t.Error("Expected least recently used entry 'b' to be evicted")
+	}
+	if _, ok, _ := mc.Get("a"); !ok {
+		t.Error("Expected 'a' to remain cached")
+	}
+
+	mc.Put("old", &CachedResponse{ExpiresAt: time.Now().Add(-time.Second)})
+	if _, ok, _ := mc.Get("old"); ok {
+		t.Error("Expected expired entry to be a miss")
+	}
+}
+
+// TestDiskCache tests round-tripping entries through the disk store.
+func TestDiskCache(t *testing.T) {
+	dc, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	entry := &CachedResponse{
+		Response: RichResponse{Content: textContent("hi"), StopReason: "end_turn"},
+		Chunks:   []string{"h", "i"},
+	}
+	if err := dc.Put("key", entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, ok, err := dc.Get("key")
+	if err != nil || !ok {
+		t.Fatalf("Expected hit, got ok=%t err=%v", ok, err)
+	}
+	if got.Response.Text() != "hi" || len(got.Chunks) != 2 {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+	if _, ok, _ := dc.Get("missing"); ok {
+		t.Error("Expected miss for missing key")
+	}
+}
+
+// TestSplitChunks tests splitting text at word boundaries.
+func TestSplitChunks(t *testing.T) {
+	got := splitChunks("Hello,  world!\nBye")
+	want := []string{"Hello,  ", "world!\n", "Bye"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
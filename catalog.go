@@ -0,0 +1,176 @@
+package llmapi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ==========================================================================
+// Model Catalog
+// ==========================================================================
+
+// ModelCatalog maps model names to capabilities, so limits can be queried
+// without creating a conversation and providers can answer
+// GetCapabilities from it. It is safe for concurrent use.
+//
+// Like PricingTable, lookups fall back to the longest registered prefix,
+// so an entry for a model family covers its dated snapshots. Overrides
+// registered for any prefix of the model are then applied from the
+// shortest prefix to the longest, so a family entry can be adjusted for
+// individual models.
+type ModelCatalog struct {
+	mu        sync.RWMutex
+	models    map[string]catalogEntry
+	overrides map[string][]func(*Capabilities)
+}
+
+type catalogEntry struct {
+	provider Provider
+	caps     Capabilities
+}
+
+// NewModelCatalog creates an empty model catalog.
+func NewModelCatalog() *ModelCatalog {
+	return &ModelCatalog{
+		models:    make(map[string]catalogEntry),
+		overrides: make(map[string][]func(*Capabilities)),
+	}
+}
+
+// Set registers or replaces the capabilities of a model or model prefix.
+func (mc *ModelCatalog) Set(provider Provider, model string, caps Capabilities) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.models[model] = catalogEntry{provider: provider, caps: caps}
+}
+
+// Override registers a change applied to the capabilities of every model
+// starting with prefix.
+func (mc *ModelCatalog) Override(prefix string, fn func(*Capabilities)) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.overrides[prefix] = append(mc.overrides[prefix], fn)
+}
+
+// Lookup returns the capabilities of model, with overrides applied.
+func (mc *ModelCatalog) Lookup(model string) (Capabilities, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	entry, ok := lookupPrefix(mc.models, model)
+	if !ok {
+		return Capabilities{}, false
+	}
+	caps := entry.caps
+	caps.SupportedImageTypes = append([]string(nil), caps.SupportedImageTypes...)
+	caps.SupportedAudioTypes = append([]string(nil), caps.SupportedAudioTypes...)
+
+	var prefixes []string
+	for prefix := range mc.overrides {
+		if strings.HasPrefix(model, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		for _, fn := range mc.overrides[prefix] {
+			fn(&caps)
+		}
+	}
+	return caps, true
+}
+
+// Provider returns the provider that serves model.
+func (mc *ModelCatalog) Provider(model string) (Provider, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	entry, ok := lookupPrefix(mc.models, model)
+	return entry.provider, ok
+}
+
+// Models returns the registered model names and prefixes, sorted.
+func (mc *ModelCatalog) Models() []string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	names := make([]string, 0, len(mc.models))
+	for name := range mc.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupPrefix returns the value for key, trying an exact match first and
+// then the longest prefix of key present in m. Prefixes must end at a "-"
+// boundary, so an entry for "gpt-4" does not match "gpt-4o".
+func lookupPrefix[V any](m map[string]V, key string) (V, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	var best string
+	var found bool
+	for name := range m {
+		if !strings.HasPrefix(key, name) {
+			continue
+		}
+		if !strings.HasSuffix(name, "-") && key[len(name)] != '-' {
+			continue
+		}
+		if !found || len(name) > len(best) {
+			best, found = name, true
+		}
+	}
+	if !found {
+		var zero V
+		return zero, false
+	}
+	return m[best], true
+}
+
+// ==========================================================================
+// Default Catalog
+// ==========================================================================
+
+// DefaultCatalog holds published limits for well-known models. It may be
+// extended or adjusted at startup with Set and Override.
+var DefaultCatalog = newDefaultCatalog()
+
+func newDefaultCatalog() *ModelCatalog {
+	mc := NewModelCatalog()
+
+	claude := Capabilities{
+		SupportsImages:      true,
+		SupportsDocuments:   true,
+		SupportsToolUse:     true,
+		SupportsStreaming:   true,
+		MaxImageSize:        5 * 1024 * 1024,
+		SupportedImageTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+
+		ContextWindow:       200_000,
+		MaxOutputTokens:     4096,
+		MaxImagesPerRequest: 100,
+		MaxDocumentPages:    100,
+
+		SupportsSystemPrompt:      true,
+		SupportsStopSequences:     true,
+		SupportsTopK:              true,
+		SupportsPromptCaching:     true,
+		SupportsParallelToolCalls: true,
+		SupportsToolChoice:        true,
+		SupportsRichToolResults:   true,
+	}
+	mc.Set(ProviderAnthropic, "claude-", claude)
+
+	withOutput := func(tokens int, thinking bool) func(*Capabilities) {
+		return func(c *Capabilities) {
+			c.MaxOutputTokens = tokens
+			c.SupportsThinking = thinking
+		}
+	}
+	mc.Override("claude-3-5-", withOutput(8192, false))
+	mc.Override("claude-3-7-sonnet", withOutput(64_000, true))
+	mc.Override("claude-sonnet-4", withOutput(64_000, true))
+	mc.Override("claude-opus-4", withOutput(32_000, true))
+	mc.Override("claude-haiku-4", withOutput(64_000, true))
+	return mc
+}
@@ -0,0 +1,81 @@
+package llmapi
+
+import "testing"
+
+// TestModelCatalog tests prefix lookups and overrides.
+func TestModelCatalog(t *testing.T) {
+	mc := NewModelCatalog()
+	mc.Set(ProviderAnthropic, "family-", Capabilities{
+		SupportsImages:      true,
+		ContextWindow:       100_000,
+		MaxOutputTokens:     1000,
+		SupportedImageTypes: []string{"image/png"},
+	})
+	mc.Set(ProviderNovelAI, "other", Capabilities{ContextWindow: 8192})
+	mc.Override("family-", func(c *Capabilities) { c.MaxOutputTokens = 2000 })
+	mc.Override("family-large", func(c *Capabilities) { c.MaxOutputTokens *= 4 })
+
+	tests := []struct {
+		model      string
+		wantOK     bool
+		wantOutput int
+		wantWindow int
+	}{
+		{"family-small-2025", true, 2000, 100_000},
+		{"family-large-2025", true, 8000, 100_000},
+		{"other", true, 0, 8192},
+		{"unknown", false, 0, 0},
+	}
+	for _, tt := range tests {
+		caps, ok := mc.Lookup(tt.model)
+		if ok != tt.wantOK || caps.MaxOutputTokens != tt.wantOutput || caps.ContextWindow != tt.wantWindow {
+			t.Errorf("Lookup(%q) = (output %d, window %d, %v), want (%d, %d, %v)",
+				tt.model, caps.MaxOutputTokens, caps.ContextWindow, ok, tt.wantOutput, tt.wantWindow, tt.wantOK)
+		}
+	}
+
+	if p, _ := mc.Provider("family-small"); p != ProviderAnthropic {
+		t.Errorf("Expected provider anthropic, got %q", p)
+	}
+
+	// Overrides must not leak into the registered entry.
+	mc.Override("family-small", func(c *Capabilities) { c.SupportedImageTypes[0] = "image/gif" })
+	mc.Lookup("family-small")
+	if caps, _ := mc.Lookup("family-large"); caps.SupportedImageTypes[0] != "image/png" {
+		t.Errorf("Expected override to leave entry unchanged, got %v", caps.SupportedImageTypes)
+	}
+
+	if got := mc.Models(); len(got) != 2 || got[0] != "family-" {
+		t.Errorf("Models() = %v", got)
+	}
+}
+
+// TestDefaultCatalog tests a few published limits.
+func TestDefaultCatalog(t *testing.T) {
+	caps, ok := DefaultCatalog.Lookup("claude-sonnet-4-20250514")
+	if !ok {
+		t.Fatal("Expected claude-sonnet-4 in the default catalog")
+	}
+	if caps.ContextWindow != 200_000 || caps.MaxOutputTokens != 64_000 || !caps.SupportsThinking {
+		t.Errorf("Unexpected capabilities: %+v", caps)
+	}
+	if caps, _ := DefaultCatalog.Lookup("claude-3-haiku-20240307"); caps.MaxOutputTokens != 4096 || caps.SupportsThinking {
+		t.Errorf("Unexpected claude-3-haiku capabilities: %+v", caps)
+	}
+}
+
+// TestContextManagerCatalog tests falling back to catalog context windows.
+func TestContextManagerCatalog(t *testing.T) {
+	cm := NewContextManager(DropOldest{})
+	if _, ok := cm.Window("claude-opus-4"); ok {
+		t.Error("Expected no window without a catalog")
+	}
+	cm.Catalog = DefaultCatalog
+	if w, ok := cm.Window("claude-opus-4"); !ok || w != 200_000 {
+		t.Errorf("Expected catalog window 200000, got %d, %v", w, ok)
+	}
+	cm.SetWindow("claude-opus-4", 1000)
+	if w, _ := cm.Window("claude-opus-4-1"); w != 1000 {
+		t.Errorf("Expected explicit window to take precedence, got %d", w)
+	}
+}
@@ -0,0 +1,124 @@
+package llmapi
+
+import "strings"
+
+// Citation location types.
+const (
+	// CitationCharLocation cites a character range of a text document.
+	CitationCharLocation = "char_location"
+	// CitationPageLocation cites a page range of a PDF document.
+	CitationPageLocation = "page_location"
+	// CitationContentBlockLocation cites a range of blocks of a "content"
+	// document.
+	CitationContentBlockLocation = "content_block_location"
+)
+
+// Citation identifies the part of a document that supports a text block.
+// Ranges are half-open: the end index is exclusive. Character and block
+// indices are 0-based; page numbers are 1-based.
+type Citation struct {
+	// Type is the location type, e.g. CitationCharLocation.
+	Type string `json:"type"`
+	// CitedText is the cited passage, as quoted by the provider.
+	CitedText string `json:"cited_text"`
+	// DocumentIndex is the position of the cited document among all
+	// documents in the request, in order of appearance.
+	DocumentIndex int    `json:"document_index"`
+	DocumentTitle string `json:"document_title,omitempty"`
+
+	// Character range, for CitationCharLocation.
+	StartCharIndex int `json:"start_char_index,omitempty"`
+	EndCharIndex   int `json:"end_char_index,omitempty"`
+	// Page range, for CitationPageLocation.
+	StartPageNumber int `json:"start_page_number,omitempty"`
+	EndPageNumber   int `json:"end_page_number,omitempty"`
+	// Block range, for CitationContentBlockLocation.
+	StartBlockIndex int `json:"start_block_index,omitempty"`
+	EndBlockIndex   int `json:"end_block_index,omitempty"`
+}
+
+// WithCitations returns a copy of a document block with citations enabled.
+// Blocks that are not documents are returned unchanged.
+func (cb ContentBlock) WithCitations() ContentBlock {
+	if cb.Document == nil {
+		return cb
+	}
+	doc := *cb.Document
+	doc.Citations = &CitationsConfig{Enabled: true}
+	cb.Document = &doc
+	return cb
+}
+
+// ResolvedCitation is a Citation matched to the document it cites.
+type ResolvedCitation struct {
+	Citation
+	// Text is the response text the citation supports.
+	Text string
+	// Document is the cited document, or nil if DocumentIndex is out of
+	// range.
+	Document *DocumentContent
+	// Source is the cited span taken from the document itself. It falls
+	// back to CitedText when the span cannot be extracted, as for PDFs.
+	Source string
+}
+
+// CollectDocuments returns the documents in msgs, in order of appearance,
+// so that Citation.DocumentIndex can be resolved against them.
+func CollectDocuments(msgs []RichMessage) []*DocumentContent {
+	var docs []*DocumentContent
+	for _, msg := range msgs {
+		for _, block := range msg.Content {
+			if block.Type == ContentTypeDocument && block.Document != nil {
+				docs = append(docs, block.Document)
+			}
+		}
+	}
+	return docs
+}
+
+// Citations returns every citation in the response, resolved against
+// docs, the documents of the request (see CollectDocuments).
+func (rr RichResponse) Citations(docs []*DocumentContent) []ResolvedCitation {
+	var out []ResolvedCitation
+	for _, block := range rr.Content {
+		if block.Type != ContentTypeText {
+			continue
+		}
+		for _, c := range block.Citations {
+			rc := ResolvedCitation{Citation: c, Text: block.Text, Source: c.CitedText}
+			if c.DocumentIndex >= 0 && c.DocumentIndex < len(docs) {
+				rc.Document = docs[c.DocumentIndex]
+				if span, ok := citedSpan(rc.Document, c); ok {
+					rc.Source = span
+				}
+			}
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+// citedSpan extracts the span c cites from doc, if doc's source allows it.
+func citedSpan(doc *DocumentContent, c Citation) (string, bool) {
+	src := doc.Source
+	switch {
+	case c.Type == CitationCharLocation && src.Type == "text":
+		runes := []rune(src.Data)
+		if c.StartCharIndex < 0 || c.StartCharIndex > c.EndCharIndex || c.EndCharIndex > len(runes) {
+			return "", false
+		}
+		return string(runes[c.StartCharIndex:c.EndCharIndex]), true
+	case c.Type == CitationContentBlockLocation && src.Type == "content":
+		if c.StartBlockIndex < 0 || c.StartBlockIndex > c.EndBlockIndex || c.EndBlockIndex > len(src.Content) {
+			return "", false
+		}
+		var parts []string
+		for _, block := range src.Content[c.StartBlockIndex:c.EndBlockIndex] {
+			if block.Type == ContentTypeText {
+				parts = append(parts, block.Text)
+			}
+		}
+		return strings.Join(parts, "\n"), true
+	}
+	return "", false
+}
@@ -0,0 +1,61 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestCitations tests resolving response citations to their documents.
+func TestCitations(t *testing.T) {
+	history := []RichMessage{{Role: RoleUser, Content: []ContentBlock{
+		NewTextDocumentBlock(MediaTypeText, "The sky is blue. Grass is green.", "facts").WithCitations(),
+		NewDocumentBlock(MediaTypePDF, "JVBERi0=", "report").WithCitations(),
+		NewContentDocumentBlock([]ContentBlock{NewTextBlock("alpha"), NewTextBlock("beta"), NewTextBlock("gamma")}, "chunks"),
+		NewTextBlock("What colour is grass?"),
+	}}}
+	docs := CollectDocuments(history)
+	if len(docs) != 3 || docs[0].Citations == nil || !docs[0].Citations.Enabled {
+		t.Fatalf("Expected 3 documents with citations enabled on the first, got %+v", docs)
+	}
+
+	resp := RichResponse{Content: []ContentBlock{
+		NewTextBlock("According to the documents, "),
+		{Type: ContentTypeText, Text: "grass is green", Citations: []Citation{
+			{Type: CitationCharLocation, CitedText: "Grass is green.", DocumentIndex: 0, StartCharIndex: 17, EndCharIndex: 32},
+			{Type: CitationPageLocation, CitedText: "Grass: green", DocumentIndex: 1, StartPageNumber: 2, EndPageNumber: 3},
+			{Type: CitationContentBlockLocation, CitedText: "beta", DocumentIndex: 2, StartBlockIndex: 1, EndBlockIndex: 3},
+			{Type: CitationCharLocation, CitedText: "lost", DocumentIndex: 7},
+		}},
+	}}
+
+	got := resp.Citations(docs)
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 citations, got %d", len(got))
+	}
+	want := []struct {
+		source string
+		doc    *DocumentContent
+	}{
+		{"Grass is green.", docs[0]},
+		{"Grass: green", docs[1]},
+		{"beta\ngamma", docs[2]},
+		{"lost", nil},
+	}
+	for i, w := range want {
+		if got[i].Source != w.source || got[i].Document != w.doc || got[i].Text != "grass is green" {
+			t.Errorf("Citation %d: got source %q document %v text %q", i, got[i].Source, got[i].Document, got[i].Text)
+		}
+	}
+
+	data, err := json.Marshal(resp.Content[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ContentBlock
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Citations) != 4 || decoded.Citations[0].EndCharIndex != 32 {
+		t.Errorf("Expected citations to round-trip, got %s", data)
+	}
+}
@@ -0,0 +1,572 @@
+package llmapi
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ==========================================================================
+// Elision Reports
+// ==========================================================================
+
+// Elision describes content removed from a conversation's history to fit
+// its context window.
+type Elision struct {
+	// Index is the message's index in the history before trimming, or -1
+	// for a synthetic message such as an earlier summary inserted while
+	// trimming.
+	Index int
+	// Action is what was done: "dropped" (whole message removed),
+	// "tool_result_elided" or "image_removed".
+	Action string
+	// Tokens is the estimated number of tokens removed.
+	Tokens int
+}
+
+// TrimReport summarizes a trim performed by a ContextManager.
+type TrimReport struct {
+	Model        string
+	Window       int
+	TokensBefore int
+	TokensAfter  int
+	Elisions     []Elision
+}
+
+// ContextOverflowError is returned when a request cannot be trimmed to fit
+// the model's context window.
+type ContextOverflowError struct {
+	Model  string
+	Window int
+	Tokens int
+}
+
+func (e *ContextOverflowError) Error() string {
+	return fmt.Sprintf("request of %d tokens exceeds %s context window of %d after trimming",
+		e.Tokens, e.Model, e.Window)
+}
+
+// ==========================================================================
+// Trim Strategies
+// ==========================================================================
+
+// TrimStrategy reduces a conversation history to fit a token limit.
+//
+// Implementations must keep tool_use/tool_result pairs together, must not
+// modify thinking blocks or separate them from their turn, must not remove
+// the final message, and must leave the history starting with a user
+// message. They return the trimmed history and what they removed; the
+// history may still exceed maxTokens if the strategy cannot reduce it
+// further.
+//
+// Elisions index into msgs. Removed messages are reported with Action
+// "dropped" or "summarized"; the remaining messages keep their order, and
+// any messages a strategy inserts (such as a summary) come before them.
+// TrimChain relies on this to report indices into the original history.
+type TrimStrategy interface {
+	Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision)
+}
+
+// historyUnits groups message indices into units that must be kept or
+// dropped together: an assistant message containing tool_use is joined
+// with the following message carrying its results, and an assistant
+// message containing thinking is joined with the rest of its turn, up to
+// the next user message that is not a tool result.
+func historyUnits(msgs []RichMessage) [][]int {
+	var units [][]int
+	for i := 0; i < len(msgs); i++ {
+		unit := []int{i}
+		thinking := false
+		for i+1 < len(msgs) {
+			thinking = thinking || hasThinking(msgs[i])
+			next := msgs[i+1]
+			if len(toolUseIDs(msgs[i])) == 0 &&
+				!(thinking && (next.Role != RoleUser || len(toolResultIDs(next)) > 0)) {
+				break
+			}
+			i++
+			unit = append(unit, i)
+		}
+		units = append(units, unit)
+	}
+	return units
+}
+
+// hasThinking reports whether msg contains a thinking block.
+func hasThinking(msg RichMessage) bool {
+	for _, block := range msg.Content {
+		if block.Type == ContentTypeThinking || block.Type == ContentTypeRedactedThinking {
+			return true
+		}
+	}
+	return false
+}
+
+// dropUnits removes the given units from msgs, recording an elision for
+// each dropped message.
+func dropUnits(msgs []RichMessage, units [][]int, drop map[int]bool) ([]RichMessage, []Elision) {
+	var out []RichMessage
+	var elided []Elision
+	for u, unit := range units {
+		for _, i := range unit {
+			if drop[u] {
+				elided = append(elided, Elision{Index: i, Action: "dropped", Tokens: estimateBlockTokens(msgs[i].Content)})
+			} else {
+				out = append(out, msgs[i])
+			}
+		}
+	}
+	return out, elided
+}
+
+// DropOldest drops the oldest turns until the history fits, keeping the
+// history starting with a user message.
+type DropOldest struct{}
+
+// Trim implements TrimStrategy.
+func (DropOldest) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	units := historyUnits(msgs)
+	drop := make(map[int]bool)
+	out := msgs
+	var elided []Elision
+	for u := 1; u < len(units) && count(out) > maxTokens; u++ {
+		// Only cut where the remaining history starts with a user message.
+		if msgs[units[u][0]].Role != RoleUser {
+			continue
+		}
+		for d := 0; d < u; d++ {
+			drop[d] = true
+		}
+		out, elided = dropUnits(msgs, units, drop)
+	}
+	return out, elided
+}
+
+// KeepFirstLast keeps the first First and last Last messages and drops
+// everything between them. The boundaries widen as needed so tool_use and
+// tool_result pairs and thinking turns are not split, and the tail shrinks
+// (or, if only the final message is left, widens) as needed so user and
+// assistant roles still alternate and the history starts with a user
+// message.
+type KeepFirstLast struct {
+	First int
+	Last  int
+}
+
+// Trim implements TrimStrategy.
+func (k KeepFirstLast) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	if count(msgs) <= maxTokens || k.First+k.Last >= len(msgs) {
+		return msgs, nil
+	}
+	units := historyUnits(msgs)
+	drop := make(map[int]bool)
+	lastStart := len(msgs) - max(k.Last, 1)
+	for u, unit := range units {
+		if unit[0] >= k.First && unit[len(unit)-1] < lastStart {
+			drop[u] = true
+		}
+	}
+	// Keep roles alternating where the head and tail meet. With no head,
+	// the tail must start with a user message.
+	prev := RoleAssistant
+	for u, unit := range units {
+		if drop[u] {
+			continue
+		}
+		if unit[0] >= k.First && msgs[unit[0]].Role == prev {
+			if u < len(units)-1 {
+				drop[u] = true
+				continue
+			}
+			// The final unit cannot be dropped, so widen the tail back
+			// to a unit that keeps the roles alternating.
+			for v := u - 1; v >= 0 && drop[v]; v-- {
+				drop[v] = false
+				if msgs[units[v][0]].Role != prev {
+					break
+				}
+			}
+		}
+		if unit[0] >= k.First {
+			break
+		}
+		prev = msgs[unit[len(unit)-1]].Role
+	}
+	return dropUnits(msgs, units, drop)
+}
+
+// ElideToolResults replaces the content of tool results larger than
+// MinTokens, oldest first, until the history fits. The tool_result block
+// itself is kept so pairing remains valid.
+type ElideToolResults struct {
+	MinTokens int
+}
+
+// Trim implements TrimStrategy.
+func (e ElideToolResults) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	return replaceBlocks(msgs, maxTokens, count, "tool_result_elided", func(block ContentBlock) (ContentBlock, bool) {
+		if block.Type != ContentTypeToolResult || block.ToolResult == nil {
+			return block, false
+		}
+		if estimateBlockTokens([]ContentBlock{block}) < e.MinTokens {
+			return block, false
+		}
+		elided := *block.ToolResult
+		elided.Content = "[tool result elided to save context]"
+		elided.Blocks = nil
+		block.ToolResult = &elided
+		return block, true
+	})
+}
+
+// RemoveImages replaces images, oldest first, with a text placeholder
+// until the history fits.
+type RemoveImages struct{}
+
+// Trim implements TrimStrategy.
+func (RemoveImages) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	return replaceBlocks(msgs, maxTokens, count, "image_removed", func(block ContentBlock) (ContentBlock, bool) {
+		if block.Type == ContentTypeToolResult && block.ToolResult != nil {
+			return removeToolResultImages(block)
+		}
+		if block.Type != ContentTypeImage {
+			return block, false
+		}
+		return NewTextBlock(removedImageText), true
+	})
+}
+
+const removedImageText = "[image removed to save context]"
+
+// removeToolResultImages replaces the images in a rich tool result.
+func removeToolResultImages(block ContentBlock) (ContentBlock, bool) {
+	var blocks []ContentBlock
+	for i, inner := range block.ToolResult.Blocks {
+		if inner.Type != ContentTypeImage {
+			if blocks != nil {
+				blocks = append(blocks, inner)
+			}
+			continue
+		}
+		if blocks == nil {
+			blocks = append([]ContentBlock(nil), block.ToolResult.Blocks[:i]...)
+		}
+		blocks = append(blocks, NewTextBlock(removedImageText))
+	}
+	if blocks == nil {
+		return block, false
+	}
+	result := *block.ToolResult
+	result.Blocks = blocks
+	result.Content = result.Text()
+	block.ToolResult = &result
+	return block, true
+}
+
+// replaceBlocks applies replace to blocks, oldest message first, until
+// the history fits. The final message is never modified.
+func replaceBlocks(msgs []RichMessage, maxTokens int, count func([]RichMessage) int, action string,
+	replace func(ContentBlock) (ContentBlock, bool)) ([]RichMessage, []Elision) {
+	out := append([]RichMessage(nil), msgs...)
+	var elided []Elision
+	for i := 0; i < len(out)-1 && count(out) > maxTokens; i++ {
+		var content []ContentBlock
+		changed := false
+		for j, block := range out[i].Content {
+			nb, ok := replace(block)
+			if ok && !changed {
+				content = append([]ContentBlock(nil), out[i].Content[:j]...)
+				changed = true
+			}
+			if changed {
+				content = append(content, nb)
+			}
+		}
+		if changed {
+			before := estimateBlockTokens(out[i].Content)
+			out[i] = RichMessage{Role: out[i].Role, Content: content}
+			elided = append(elided, Elision{Index: i, Action: action, Tokens: before - estimateBlockTokens(content)})
+		}
+	}
+	return out, elided
+}
+
+// TrimChain applies strategies in order until the history fits.
+type TrimChain []TrimStrategy
+
+// Trim implements TrimStrategy. Elision indices from every strategy are
+// mapped back to the history passed to the chain.
+func (c TrimChain) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	// origin maps each current message to its original index.
+	origin := make([]int, len(msgs))
+	for i := range origin {
+		origin[i] = i
+	}
+	var all []Elision
+	for _, s := range c {
+		if count(msgs) <= maxTokens {
+			break
+		}
+		out, elided := s.Trim(msgs, maxTokens, count)
+		removed := make(map[int]bool)
+		for _, e := range elided {
+			if e.Action == "dropped" || e.Action == "summarized" {
+				removed[e.Index] = true
+			}
+			if e.Index >= 0 && e.Index < len(origin) {
+				e.Index = origin[e.Index]
+			}
+			all = append(all, e)
+		}
+		kept := make([]int, 0, len(out))
+		for i, o := range origin {
+			if !removed[i] {
+				kept = append(kept, o)
+			}
+		}
+		origin = make([]int, 0, len(out))
+		for len(origin)+len(kept) < len(out) {
+			origin = append(origin, -1)
+		}
+		origin = append(origin, kept...)
+		msgs = out
+	}
+	return msgs, all
+}
+
+// ==========================================================================
+// Context Manager
+// ==========================================================================
+
+// ContextManager keeps conversations within their model's context window.
+// It is safe for concurrent use.
+type ContextManager struct {
+	// Strategy trims history when a request would overflow.
+	Strategy TrimStrategy
+	// ReserveTokens are kept free for the model's output.
+	// Defaults to DefaultSettings.MaxTokens.
+	ReserveTokens int
+	// TriggerTokens, if set, trims the history as soon as a request would
+	// exceed this many input tokens, even if it still fits the window.
+	TriggerTokens int
+	// Catalog, if set, supplies the ContextWindow of models with no
+	// window set by SetWindow.
+	Catalog *ModelCatalog
+
+	mu      sync.RWMutex
+	windows map[string]int
+}
+
+// NewContextManager creates a manager using strategy to trim history.
+func NewContextManager(strategy TrimStrategy) *ContextManager {
+	return &ContextManager{
+		Strategy:      strategy,
+		ReserveTokens: DefaultSettings.MaxTokens,
+		windows:       make(map[string]int),
+	}
+}
+
+// SetWindow sets a model's context window size in tokens. Like
+// PricingTable, lookups fall back to the longest matching prefix.
+func (cm *ContextManager) SetWindow(model string, tokens int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.windows[model] = tokens
+}
+
+// Window returns the context window size for model.
+func (cm *ContextManager) Window(model string) (int, bool) {
+	cm.mu.RLock()
+	window, ok := lookupPrefix(cm.windows, model)
+	cm.mu.RUnlock()
+	if ok || cm.Catalog == nil {
+		return window, ok
+	}
+	caps, ok := cm.Catalog.Lookup(model)
+	return caps.ContextWindow, ok && caps.ContextWindow > 0
+}
+
+// Fit trims conv's history so that sending content fits model's context
+// window (or TriggerTokens, if lower), replacing the history through Clear
+// and AddRichMessage. It returns a report, or nil if nothing was trimmed,
+// and a *ContextOverflowError if the request cannot be made to fit the
+// window.
+func (cm *ContextManager) Fit(conv Conversation, model string, content []ContentBlock) (*TrimReport, error) {
+	window, ok := cm.Window(model)
+	if !ok && cm.TriggerTokens <= 0 {
+		return nil, nil
+	}
+	msgs := conv.GetRichMessages()
+	// Count everything with the same counter, so that the history
+	// limit is in the same units as the window.
+	blocks := contentCounter(conv)
+	count := historyCounter(blocks)
+	before := count(msgs)
+	fixed := estimateFixedTokens(conv, content, blocks)
+
+	windowLimit := math.MaxInt
+	if ok {
+		windowLimit = window - cm.ReserveTokens - fixed
+	}
+	limit := windowLimit
+	if cm.TriggerTokens > 0 {
+		limit = min(limit, cm.TriggerTokens-fixed)
+	}
+	if before <= limit {
+		return nil, nil
+	}
+
+	var elided []Elision
+	if cm.Strategy != nil {
+		msgs, elided = cm.Strategy.Trim(msgs, limit, count)
+	}
+	after := count(msgs)
+	if len(elided) > 0 {
+		conv.Clear()
+		for _, msg := range msgs {
+			conv.AddRichMessage(msg.Role, msg.Content)
+		}
+	}
+	report := &TrimReport{
+		Model:        model,
+		Window:       window,
+		TokensBefore: before + fixed,
+		TokensAfter:  after + fixed,
+		Elisions:     elided,
+	}
+	if after > windowLimit {
+		return report, &ContextOverflowError{Model: model, Window: window, Tokens: after + fixed + cm.ReserveTokens}
+	}
+	return report, nil
+}
+
+// historyTokens estimates the tokens in a message history.
+func historyTokens(msgs []RichMessage) int {
+	n := 0
+	for _, msg := range msgs {
+		n += estimateBlockTokens(msg.Content)
+	}
+	return n
+}
+
+// historyCounter returns a history counter that counts each message with
+// countBlocks only once, so trim loops re-counting the history after every
+// step do not re-decode its images. Messages are identified by their
+// content array, which strategies replace rather than modify.
+func historyCounter(countBlocks func([]ContentBlock) int) func([]RichMessage) int {
+	type contentKey struct {
+		first *ContentBlock
+		n     int
+	}
+	memo := make(map[contentKey]int)
+	return func(msgs []RichMessage) int {
+		n := 0
+		for _, msg := range msgs {
+			if len(msg.Content) == 0 {
+				continue
+			}
+			key := contentKey{&msg.Content[0], len(msg.Content)}
+			tokens, ok := memo[key]
+			if !ok {
+				tokens = countBlocks(msg.Content)
+				memo[key] = tokens
+			}
+			n += tokens
+		}
+		return n
+	}
+}
+
+// ==========================================================================
+// Context Decorator
+// ==========================================================================
+
+// ManagedConversation wraps a Conversation and fits its history to the
+// model's context window with a ContextManager before every send.
+type ManagedConversation struct {
+	Conversation
+	manager *ContextManager
+	model   string
+
+	mu       sync.Mutex
+	lastTrim *TrimReport
+}
+
+// WithContextManager wraps conv so its history is trimmed before each
+// send. model is the conversation's current model; it is updated by
+// SetModel.
+func WithContextManager(conv Conversation, manager *ContextManager, model string) *ManagedConversation {
+	return &ManagedConversation{Conversation: conv, manager: manager, model: model}
+}
+
+// SetModel changes the model for subsequent calls and window lookups.
+func (mc *ManagedConversation) SetModel(model string) {
+	mc.model = model
+	mc.Conversation.SetModel(model)
+}
+
+// LastTrim returns the report of the most recent trim, or nil if the
+// history has never been trimmed.
+func (mc *ManagedConversation) LastTrim() *TrimReport {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.lastTrim
+}
+
+func (mc *ManagedConversation) fit(content []ContentBlock) error {
+	report, err := mc.manager.Fit(mc.Conversation, mc.model, content)
+	if report != nil {
+		mc.mu.Lock()
+		mc.lastTrim = report
+		mc.mu.Unlock()
+	}
+	return err
+}
+
+// Send fits the history, then forwards to the wrapped conversation.
+func (mc *ManagedConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	if err := mc.fit(textContent(text)); err != nil {
+		return "", "", 0, 0, err
+	}
+	return mc.Conversation.Send(text, sampling)
+}
+
+// SendStreaming fits the history, then forwards to the wrapped conversation.
+func (mc *ManagedConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	if err := mc.fit(textContent(text)); err != nil {
+		return "", "", 0, 0, err
+	}
+	return mc.Conversation.SendStreaming(text, sampling, callback)
+}
+
+// SendUntilDone fits the history before each request, then forwards to
+// the wrapped conversation's Send.
+func (mc *ManagedConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	return untilDone(text, func(text string) (string, string, int, int, error) {
+		return mc.Send(text, sampling)
+	})
+}
+
+// SendStreamingUntilDone fits the history before each request, then
+// forwards to the wrapped conversation's SendStreaming.
+func (mc *ManagedConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return untilDone(text, func(text string) (string, string, int, int, error) {
+		return mc.SendStreaming(text, sampling, callback)
+	})
+}
+
+// SendRich fits the history, then forwards to the wrapped conversation.
+func (mc *ManagedConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	if err := mc.fit(content); err != nil {
+		return nil, err
+	}
+	return mc.Conversation.SendRich(content, sampling)
+}
+
+// SendRichStreaming fits the history, then forwards to the wrapped conversation.
+func (mc *ManagedConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	if err := mc.fit(content); err != nil {
+		return nil, err
+	}
+	return mc.Conversation.SendRichStreaming(content, sampling, callback)
+}
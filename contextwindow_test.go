@@ -0,0 +1,213 @@
+package llmapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// longText returns text estimated at roughly n tokens.
+func longText(n int) string {
+	return strings.Repeat("abcd", n)
+}
+
+// TestTrimStrategies tests each built-in strategy on a tool-using history.
+func TestTrimStrategies(t *testing.T) {
+	msgs := []RichMessage{
+		{Role: RoleUser, Content: textContent(longText(100))}, // 0
+		toolUseMessage("a"), // 1
+		{Role: RoleUser, Content: []ContentBlock{NewToolResultBlock("a", longText(300), false)}},          // 2
+		{Role: RoleAssistant, Content: textContent(longText(100))},                                        // 3
+		{Role: RoleUser, Content: []ContentBlock{NewImageBlock(MediaTypePNG, "x"), NewTextBlock("look")}}, // 4
+		{Role: RoleAssistant, Content: textContent("ok")},                                                 // 5
+		{Role: RoleUser, Content: textContent("last")},                                                    // 6
+	}
+
+	t.Run("DropOldest", func(t *testing.T) {
+		out, elided := DropOldest{}.Trim(msgs, 1700, historyTokens)
+		if historyTokens(out) > 1700 {
+			t.Errorf("Expected history to fit, got %d tokens", historyTokens(out))
+		}
+		if out[0].Role != RoleUser {
+			t.Errorf("Expected trimmed history to start with a user message")
+		}
+		if err := ValidateToolPairing(out); err != nil {
+			t.Errorf("Expected valid pairing, got %v", err)
+		}
+		if len(elided) != 4 || elided[1].Index != 1 || elided[2].Index != 2 {
+			t.Errorf("Expected messages 0-3 dropped, got %+v", elided)
+		}
+	})
+
+	t.Run("KeepFirstLast", func(t *testing.T) {
+		out, _ := KeepFirstLast{First: 2, Last: 2}.Trim(msgs, 10, historyTokens)
+		if err := ValidateToolPairing(out); err != nil {
+			t.Errorf("Expected valid pairing, got %v", err)
+		}
+		// The tool pair at 1-2 straddles the head boundary and is kept whole.
+		if len(out) != 5 || out[3].Role != RoleAssistant || out[4].ToMessage().Content != "last" {
+			t.Errorf("Unexpected result: %+v", out)
+		}
+	})
+
+	t.Run("ElideToolResults", func(t *testing.T) {
+		out, elided := ElideToolResults{MinTokens: 50}.Trim(msgs, 2000, historyTokens)
+		if len(out) != len(msgs) || len(elided) != 1 || elided[0].Index != 2 {
+			t.Errorf("Expected tool result at 2 elided, got %+v", elided)
+		}
+		if err := ValidateToolPairing(out); err != nil {
+			t.Errorf("Expected valid pairing, got %v", err)
+		}
+		if msgs[2].Content[0].ToolResult.Content != longText(300) {
+			t.Error("Expected original history to be unmodified")
+		}
+	})
+
+	t.Run("RemoveImages", func(t *testing.T) {
+		out, elided := RemoveImages{}.Trim(msgs, 0, historyTokens)
+		if len(elided) != 1 || elided[0].Index != 4 || out[4].Content[0].Type != ContentTypeText {
+			t.Errorf("Expected image at 4 replaced, got %+v", elided)
+		}
+	})
+}
+
+// TestTrimThinkingTurns tests that thinking turns are trimmed whole and
+// the history always starts with a user message.
+func TestTrimThinkingTurns(t *testing.T) {
+	thinkingToolUse := toolUseMessage("a")
+	thinkingToolUse.Content = append([]ContentBlock{NewSignedThinkingBlock("plan", "sig")}, thinkingToolUse.Content...)
+	msgs := []RichMessage{
+		{Role: RoleUser, Content: textContent(longText(100))}, // 0
+		thinkingToolUse,        // 1
+		toolResultMessage("a"), // 2
+		{Role: RoleAssistant, Content: textContent(longText(100))}, // 3
+		{Role: RoleUser, Content: textContent("next")},             // 4
+		{Role: RoleAssistant, Content: textContent("done")},        // 5
+	}
+	if units := historyUnits(msgs); len(units) != 4 || len(units[1]) != 3 {
+		t.Errorf("Expected the thinking turn 1-3 as one unit, got %v", units)
+	}
+
+	out, elided := DropOldest{}.Trim(msgs, 10, historyTokens)
+	if len(out) != 2 || out[0].Role != RoleUser || len(elided) != 4 {
+		t.Errorf("Expected messages 0-3 dropped together, got %d messages and %+v", len(out), elided)
+	}
+
+	// The final unit starts with an assistant message, so it cannot be
+	// the only one left.
+	tail := []RichMessage{
+		{Role: RoleUser, Content: textContent(longText(100))},
+		{Role: RoleAssistant, Content: textContent(longText(100))},
+	}
+	if out, _ := (DropOldest{}).Trim(tail, 10, historyTokens); out[0].Role != RoleUser {
+		t.Errorf("Expected the history to start with a user message, got %+v", out)
+	}
+	if out, _ := (KeepFirstLast{Last: 1}).Trim(msgs, 10, historyTokens); out[0].Role != RoleUser {
+		t.Errorf("Expected KeepFirstLast to start with a user message, got %+v", out[0])
+	}
+}
+
+// TestTrimChainIndices tests that a chain reports original indices.
+func TestTrimChainIndices(t *testing.T) {
+	msgs := []RichMessage{
+		{Role: RoleUser, Content: textContent("first")},                                                   // 0
+		{Role: RoleAssistant, Content: textContent(longText(100))},                                        // 1
+		{Role: RoleUser, Content: textContent(longText(100))},                                             // 2
+		{Role: RoleAssistant, Content: textContent("ok")},                                                 // 3
+		{Role: RoleUser, Content: []ContentBlock{NewImageBlock(MediaTypePNG, "x"), NewTextBlock("look")}}, // 4
+		{Role: RoleAssistant, Content: textContent("ok")},                                                 // 5
+		{Role: RoleUser, Content: textContent("last")},                                                    // 6
+	}
+	_, elided := TrimChain{KeepFirstLast{First: 1, Last: 4}, RemoveImages{}}.Trim(msgs, 0, historyTokens)
+	var indices []int
+	for _, e := range elided {
+		indices = append(indices, e.Index)
+	}
+	if want := []int{1, 2, 4}; !reflect.DeepEqual(indices, want) || elided[2].Action != "image_removed" {
+		t.Errorf("Expected elisions at %v, got %+v", want, elided)
+	}
+
+	count := historyCounter(estimateBlockTokens)
+	if got, want := count(msgs), historyTokens(msgs); got != want || count(msgs) != want {
+		t.Errorf("historyCounter = %d, want %d", got, want)
+	}
+	trimmed, _ := RemoveImages{}.Trim(msgs, 0, count)
+	if got, want := count(trimmed), historyTokens(trimmed); got != want {
+		t.Errorf("historyCounter after trimming = %d, want %d", got, want)
+	}
+}
+
+// TestContextManager tests fitting a conversation to its window.
+func TestContextManager(t *testing.T) {
+	cm := NewContextManager(TrimChain{RemoveImages{}, DropOldest{}})
+	cm.ReserveTokens = 100
+	cm.SetWindow("mock", 400)
+
+	mock := newMockConversation("")
+	for i := 0; i < 5; i++ {
+		mock.AddMessage(RoleUser, longText(50))
+		mock.AddMessage(RoleAssistant, longText(50))
+	}
+	conv := WithContextManager(mock, cm, "mock-model")
+
+	if _, _, _, _, err := conv.Send("next", Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report := conv.LastTrim()
+	if report == nil || report.Window != 400 || len(report.Elisions) == 0 {
+		t.Fatalf("Expected a trim report, got %+v", report)
+	}
+	if report.TokensAfter > 300 {
+		t.Errorf("Expected history to fit in 300 tokens, got %d", report.TokensAfter)
+	}
+
+	_, err := conv.SendRich(textContent(longText(500)), Sampling{})
+	var overflow *ContextOverflowError
+	if !errors.As(err, &overflow) {
+		t.Errorf("Expected ContextOverflowError, got %v", err)
+	}
+
+	if _, ok := cm.Window("unknown"); ok {
+		t.Error("Expected no window for unknown model")
+	}
+}
+
+// countingConversation is a mock with a TokenCounter reporting twice the
+// character estimate.
+type countingConversation struct {
+	*mockConversation
+}
+
+func (c countingConversation) CountTokens(content []ContentBlock) (int, error) {
+	return 2 * estimateBlockTokens(content), nil
+}
+
+// TestContextManagerTokenCounter tests that Fit counts the history with the
+// conversation's TokenCounter.
+func TestContextManagerTokenCounter(t *testing.T) {
+	cm := NewContextManager(DropOldest{})
+	cm.ReserveTokens = 100
+	cm.SetWindow("mock", 400)
+
+	conv := countingConversation{newMockConversation("")}
+	for i := 0; i < 10; i++ {
+		conv.AddMessage(RoleUser, longText(20))
+		conv.AddMessage(RoleAssistant, longText(20))
+	}
+	report, err := cm.Fit(conv, "mock-model", textContent("next"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report == nil || report.TokensBefore != 2*(400+1) {
+		t.Fatalf("Expected counted tokens in the report, got %+v", report)
+	}
+	if report.TokensAfter > 300 {
+		t.Errorf("Expected request to fit in 300 tokens, got %d", report.TokensAfter)
+	}
+	// Each message counts 40 tokens, so 7 fit but an odd cut would leave
+	// an assistant message first.
+	if got := len(conv.GetRichMessages()); got != 6 {
+		t.Errorf("Expected 6 messages kept, got %d", got)
+	}
+}
@@ -0,0 +1,284 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ==========================================================================
+// Pricing
+// ==========================================================================
+
+// ModelPricing holds a model's prices in USD per million tokens.
+type ModelPricing struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Cost is a monetary amount in USD, broken down by token category.
+type Cost struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Total returns the sum of all cost categories.
+func (c Cost) Total() float64 {
+	return c.Input + c.Output + c.CacheRead + c.CacheWrite
+}
+
+// Add returns the category-wise sum of c and other.
+func (c Cost) Add(other Cost) Cost {
+	return Cost{
+		Input:      c.Input + other.Input,
+		Output:     c.Output + other.Output,
+		CacheRead:  c.CacheRead + other.CacheRead,
+		CacheWrite: c.CacheWrite + other.CacheWrite,
+	}
+}
+
+// Cost computes the cost of the given usage at these prices.
+func (p ModelPricing) Cost(usage Usage) Cost {
+	const perMillion = 1_000_000
+	return Cost{
+		Input:      float64(usage.InputTokens) * p.Input / perMillion,
+		Output:     float64(usage.OutputTokens) * p.Output / perMillion,
+		CacheRead:  float64(usage.CacheReadInputTokens) * p.CacheRead / perMillion,
+		CacheWrite: float64(usage.CacheCreationInputTokens) * p.CacheWrite / perMillion,
+	}
+}
+
+// PricingTable maps model names to prices. It is safe for concurrent use.
+//
+// Lookups fall back to the longest registered prefix of the model name
+// ending at a "-", so an entry for "claude-sonnet-4" also prices
+// "claude-sonnet-4-20250514" but an entry for "gpt-4" does not price
+// "gpt-4o".
+type PricingTable struct {
+	mu     sync.RWMutex
+	models map[string]ModelPricing
+}
+
+// NewPricingTable creates an empty pricing table.
+func NewPricingTable() *PricingTable {
+	return &PricingTable{models: make(map[string]ModelPricing)}
+}
+
+// LoadPricingTable reads a pricing table from JSON of the form
+// {"model-name": {"input": 3, "output": 15, "cache_read": 0.3}, ...}.
+func LoadPricingTable(r io.Reader) (*PricingTable, error) {
+	var models map[string]ModelPricing
+	if err := json.NewDecoder(r).Decode(&models); err != nil {
+		return nil, fmt.Errorf("decode pricing table: %w", err)
+	}
+	pt := NewPricingTable()
+	for model, pricing := range models {
+		pt.models[model] = pricing
+	}
+	return pt, nil
+}
+
+// LoadPricingFile reads a pricing table from a JSON file.
+func LoadPricingFile(path string) (*PricingTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadPricingTable(f)
+}
+
+// Set registers or replaces the pricing for a model.
+func (pt *PricingTable) Set(model string, pricing ModelPricing) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.models[model] = pricing
+}
+
+// Lookup returns the pricing for a model, trying an exact match first and
+// then the longest registered prefix.
+func (pt *PricingTable) Lookup(model string) (ModelPricing, bool) {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return lookupPrefix(pt.models, model)
+}
+
+// ==========================================================================
+// Cost Tracking
+// ==========================================================================
+
+// CostTracker accumulates spend across any number of conversations,
+// grouped by tag. It is safe for concurrent use.
+type CostTracker struct {
+	mu       sync.Mutex
+	pricing  *PricingTable
+	total    Cost
+	byTag    map[string]Cost
+	unpriced map[string]Usage
+}
+
+// NewCostTracker creates a tracker that prices usage with the given table.
+func NewCostTracker(pricing *PricingTable) *CostTracker {
+	return &CostTracker{
+		pricing:  pricing,
+		byTag:    make(map[string]Cost),
+		unpriced: make(map[string]Usage),
+	}
+}
+
+// record prices usage for model and adds it to the total and each tag.
+// Usage for models missing from the pricing table is tracked separately
+// and costs nothing.
+func (ct *CostTracker) record(model string, usage Usage, tags []string) Cost {
+	pricing, ok := ct.pricing.Lookup(model)
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if !ok {
+		u := ct.unpriced[model]
+		u.InputTokens += usage.InputTokens
+		u.OutputTokens += usage.OutputTokens
+		u.CacheCreationInputTokens += usage.CacheCreationInputTokens
+		u.CacheReadInputTokens += usage.CacheReadInputTokens
+		ct.unpriced[model] = u
+		return Cost{}
+	}
+	cost := pricing.Cost(usage)
+	ct.total = ct.total.Add(cost)
+	for _, tag := range tags {
+		ct.byTag[tag] = ct.byTag[tag].Add(cost)
+	}
+	return cost
+}
+
+// Total returns the spend across all tracked conversations.
+func (ct *CostTracker) Total() Cost {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.total
+}
+
+// ByTag returns a copy of the spend accumulated per tag.
+func (ct *CostTracker) ByTag() map[string]Cost {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	out := make(map[string]Cost, len(ct.byTag))
+	for k, v := range ct.byTag {
+		out[k] = v
+	}
+	return out
+}
+
+// Unpriced returns the usage recorded for models with no pricing entry.
+func (ct *CostTracker) Unpriced() map[string]Usage {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	out := make(map[string]Usage, len(ct.unpriced))
+	for k, v := range ct.unpriced {
+		out[k] = v
+	}
+	return out
+}
+
+// CostConversation wraps a Conversation and records the cost of every
+// send with a CostTracker.
+type CostConversation struct {
+	Conversation
+	tracker *CostTracker
+	model   string
+	tags    []string
+
+	mu   sync.Mutex
+	cost Cost
+}
+
+// WithCostTracking wraps conv so that its spend is recorded in tracker
+// under each of the given tags. model must be the conversation's current
+// model; it is updated by SetModel.
+func WithCostTracking(conv Conversation, tracker *CostTracker, model string, tags ...string) *CostConversation {
+	return &CostConversation{
+		Conversation: conv,
+		tracker:      tracker,
+		model:        model,
+		tags:         tags,
+	}
+}
+
+// Cost returns the spend accumulated by this conversation.
+func (cc *CostConversation) Cost() Cost {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.cost
+}
+
+// SetModel changes the model used for subsequent calls and pricing.
+func (cc *CostConversation) SetModel(model string) {
+	cc.mu.Lock()
+	cc.model = model
+	cc.mu.Unlock()
+	cc.Conversation.SetModel(model)
+}
+
+func (cc *CostConversation) record(inputTokens, outputTokens int) {
+	cc.recordUsage(Usage{InputTokens: inputTokens, OutputTokens: outputTokens})
+}
+
+func (cc *CostConversation) recordUsage(usage Usage) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.cost = cc.cost.Add(cc.tracker.record(cc.model, usage, cc.tags))
+}
+
+func (cc *CostConversation) recordRich(resp *RichResponse) {
+	if resp != nil {
+		cc.recordUsage(resp.Usage())
+	}
+}
+
+// Send forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	reply, stopReason, in, out, err := cc.Conversation.Send(text, sampling)
+	cc.record(in, out)
+	return reply, stopReason, in, out, err
+}
+
+// SendStreaming forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	reply, stopReason, in, out, err := cc.Conversation.SendStreaming(text, sampling, callback)
+	cc.record(in, out)
+	return reply, stopReason, in, out, err
+}
+
+// SendUntilDone forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	reply, stopReason, in, out, err := cc.Conversation.SendUntilDone(text, sampling)
+	cc.record(in, out)
+	return reply, stopReason, in, out, err
+}
+
+// SendStreamingUntilDone forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	reply, stopReason, in, out, err := cc.Conversation.SendStreamingUntilDone(text, sampling, callback)
+	cc.record(in, out)
+	return reply, stopReason, in, out, err
+}
+
+// SendRich forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	resp, err := cc.Conversation.SendRich(content, sampling)
+	cc.recordRich(resp)
+	return resp, err
+}
+
+// SendRichStreaming forwards to the wrapped conversation and records its cost.
+func (cc *CostConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	resp, err := cc.Conversation.SendRichStreaming(content, sampling, callback)
+	cc.recordRich(resp)
+	return resp, err
+}
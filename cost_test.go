@@ -0,0 +1,94 @@
+package llmapi
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestPricingTable tests loading and prefix lookup of model prices.
+func TestPricingTable(t *testing.T) {
+	pt, err := LoadPricingTable(strings.NewReader(`{
+		"model-a": {"input": 3, "output": 15, "cache_read": 0.3, "cache_write": 3.75},
+		"model-a-mini": {"input": 1, "output": 5}
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p, ok := pt.Lookup("model-a-20250101")
+	if !ok || p.Input != 3 || p.CacheWrite != 3.75 {
+		t.Errorf("Expected model-a pricing via prefix, got %+v (%t)", p, ok)
+	}
+	p, ok = pt.Lookup("model-a-mini-latest")
+	if !ok || p.Input != 1 {
+		t.Errorf("Expected longest prefix match model-a-mini, got %+v", p)
+	}
+	if _, ok := pt.Lookup("other"); ok {
+		t.Error("Expected lookup of unknown model to fail")
+	}
+	if _, ok := pt.Lookup("model-ab"); ok {
+		t.Error("Expected a prefix without a \"-\" boundary not to match")
+	}
+
+	cost := p.Cost(Usage{InputTokens: 1_000_000, OutputTokens: 200_000})
+	if !approxEqual(cost.Input, 1) || !approxEqual(cost.Output, 1) || !approxEqual(cost.Total(), 2) {
+		t.Errorf("Unexpected cost: %+v", cost)
+	}
+
+	p, _ = pt.Lookup("model-a")
+	cost = p.Cost(Usage{CacheReadInputTokens: 1_000_000, CacheCreationInputTokens: 1_000_000})
+	if !approxEqual(cost.CacheRead, 0.3) || !approxEqual(cost.CacheWrite, 3.75) {
+		t.Errorf("Unexpected cache cost: %+v", cost)
+	}
+
+	if _, err := LoadPricingTable(strings.NewReader("not json")); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+
+	pt, err = LoadPricingTable(strings.NewReader("null"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pt.Set("model-b", ModelPricing{Input: 1})
+	if _, ok := pt.Lookup("model-b"); !ok {
+		t.Error("Expected Set to work on a table loaded from null")
+	}
+}
+
+// TestCostConversation tests per-conversation and per-tag cost tracking.
+func TestCostConversation(t *testing.T) {
+	pt := NewPricingTable()
+	pt.Set("mock-model", ModelPricing{Input: 1_000_000, Output: 2_000_000}) // $1/$2 per token
+	tracker := NewCostTracker(pt)
+
+	a := WithCostTracking(newMockConversation(""), tracker, "mock-model", "team-a", "eval")
+	b := WithCostTracking(newMockConversation(""), tracker, "mock-model", "team-b")
+
+	a.Send("one two", Sampling{})            // 3 in, 3 out -> $9
+	b.SendRich(textContent("x"), Sampling{}) // 2 in, 2 out -> $6
+
+	if got := a.Cost().Total(); !approxEqual(got, 9) {
+		t.Errorf("Expected conversation A cost 9, got %v", got)
+	}
+	if got := tracker.Total().Total(); !approxEqual(got, 15) {
+		t.Errorf("Expected total cost 15, got %v", got)
+	}
+	tags := tracker.ByTag()
+	if !approxEqual(tags["eval"].Total(), 9) || !approxEqual(tags["team-b"].Total(), 6) {
+		t.Errorf("Unexpected per-tag costs: %+v", tags)
+	}
+
+	b.SetModel("unpriced")
+	b.Send("hi", Sampling{})
+	if u := tracker.Unpriced()["unpriced"]; u.InputTokens != 2 {
+		t.Errorf("Expected unpriced usage to be tracked, got %+v", u)
+	}
+	if got := b.Cost().Total(); !approxEqual(got, 6) {
+		t.Errorf("Expected unpriced call to add no cost, got %v", got)
+	}
+}
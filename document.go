@@ -0,0 +1,112 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedDocumentType means a file is neither a PDF nor UTF-8 text.
+var ErrUnsupportedDocumentType = errors.New("unsupported document type")
+
+// NewDocumentBlock creates a base64 document block, such as a PDF.
+func NewDocumentBlock(mediaType MediaType, base64Data, title string) ContentBlock {
+	return ContentBlock{
+		Type: ContentTypeDocument,
+		Document: &DocumentContent{
+			Source: DocumentSource{Type: "base64", MediaType: mediaType, Data: base64Data},
+			Title:  title,
+		},
+	}
+}
+
+// NewTextDocumentBlock creates a plain-text document block. mediaType
+// describes the text format, e.g. MediaTypeMarkdown.
+func NewTextDocumentBlock(mediaType MediaType, text, title string) ContentBlock {
+	return ContentBlock{
+		Type: ContentTypeDocument,
+		Document: &DocumentContent{
+			Source: DocumentSource{Type: "text", MediaType: mediaType, Data: text},
+			Title:  title,
+		},
+	}
+}
+
+// NewContentDocumentBlock creates a document block from a list of content
+// blocks, such as pre-chunked text.
+func NewContentDocumentBlock(content []ContentBlock, title string) ContentBlock {
+	return ContentBlock{
+		Type: ContentTypeDocument,
+		Document: &DocumentContent{
+			Source: DocumentSource{Type: "content", Content: content},
+			Title:  title,
+		},
+	}
+}
+
+// textDocumentTypes maps file extensions to text document media types.
+var textDocumentTypes = map[string]MediaType{
+	".txt":      MediaTypeText,
+	".text":     MediaTypeText,
+	".md":       MediaTypeMarkdown,
+	".markdown": MediaTypeMarkdown,
+	".html":     MediaTypeHTML,
+	".htm":      MediaTypeHTML,
+	".csv":      MediaTypeCSV,
+}
+
+// NewDocumentBlockFromFile reads a document file and picks its encoding:
+// PDFs (detected from their content) become base64 documents, and UTF-8
+// text becomes a text document typed by its extension, defaulting to
+// text/plain. The file name is used as the title. Anything else fails
+// with ErrUnsupportedDocumentType.
+func NewDocumentBlockFromFile(path string) (ContentBlock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+	title := filepath.Base(path)
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return NewDocumentBlock(MediaTypePDF, base64.StdEncoding.EncodeToString(data), title), nil
+	}
+	if !utf8.Valid(data) {
+		return ContentBlock{}, fmt.Errorf("%s: %w: not a PDF or UTF-8 text", path, ErrUnsupportedDocumentType)
+	}
+	mediaType, ok := textDocumentTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		mediaType = MediaTypeText
+	}
+	return NewTextDocumentBlock(mediaType, string(data), title), nil
+}
+
+// DocumentText returns the text of a "text" or "content" document. Binary
+// documents such as PDFs return false.
+func DocumentText(doc *DocumentContent) (string, bool) {
+	switch doc.Source.Type {
+	case "text":
+		return doc.Source.Data, true
+	case "content":
+		var parts []string
+		for _, block := range doc.Source.Content {
+			if block.Type == ContentTypeText {
+				parts = append(parts, block.Text)
+			}
+		}
+		return strings.Join(parts, "\n"), true
+	}
+	return "", false
+}
+
+// InlineDocumentText wraps a document's text with its title, for sending
+// a document as plain text to providers without document support.
+func InlineDocumentText(doc *DocumentContent, text string) string {
+	if doc.Title == "" {
+		return "<document>\n" + text + "\n</document>"
+	}
+	return fmt.Sprintf("<document title=%q>\n%s\n</document>", doc.Title, text)
+}
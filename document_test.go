@@ -0,0 +1,97 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestNewDocumentBlockFromFile tests picking the document encoding.
+func TestNewDocumentBlockFromFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantSource string
+		wantType   MediaType
+	}{
+		{"report.pdf", []byte("%PDF-1.7\n..."), "base64", MediaTypePDF},
+		{"notes.md", []byte("# Notes"), "text", MediaTypeMarkdown},
+		{"table.CSV", []byte("a,b\n1,2"), "text", MediaTypeCSV},
+		{"page.html", []byte("<p>hi</p>"), "text", MediaTypeHTML},
+		{"README", []byte("plain"), "text", MediaTypeText},
+	}
+	for _, tt := range tests {
+		block, err := NewDocumentBlockFromFile(write(tt.name, tt.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		src := block.Document.Source
+		if src.Type != tt.wantSource || src.MediaType != tt.wantType || block.Document.Title != tt.name {
+			t.Errorf("%s: got source %q %s title %q", tt.name, src.Type, src.MediaType, block.Document.Title)
+		}
+	}
+
+	_, err := NewDocumentBlockFromFile(write("blob.bin", []byte{0xff, 0xfe, 0x00}))
+	if !errors.Is(err, ErrUnsupportedDocumentType) {
+		t.Errorf("Expected ErrUnsupportedDocumentType, got %v", err)
+	}
+}
+
+// TestDocumentText tests text extraction and inline fallback.
+func TestDocumentText(t *testing.T) {
+	text := NewTextDocumentBlock(MediaTypeMarkdown, "# Title", "notes.md")
+	if got, ok := DocumentText(text.Document); !ok || got != "# Title" {
+		t.Errorf("DocumentText(text) = %q, %v", got, ok)
+	}
+	content := NewContentDocumentBlock([]ContentBlock{NewTextBlock("one"), NewTextBlock("two")}, "")
+	if got, ok := DocumentText(content.Document); !ok || got != "one\ntwo" {
+		t.Errorf("DocumentText(content) = %q, %v", got, ok)
+	}
+	if _, ok := DocumentText(NewDocumentBlock(MediaTypePDF, "JVBERi0=", "").Document); ok {
+		t.Error("Expected no text for a PDF")
+	}
+
+	if got := InlineDocumentText(text.Document, "# Title"); got != "<document title=\"notes.md\">\n# Title\n</document>" {
+		t.Errorf("InlineDocumentText = %q", got)
+	}
+
+	out, changes, err := Negotiate([]ContentBlock{text}, Capabilities{}, NegotiationPolicy{Action: NegotiateTransform})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Action != "transformed" || out[0].Text != InlineDocumentText(text.Document, "# Title") {
+		t.Errorf("Expected inline text fallback, got %+v", out)
+	}
+
+	msg := RichMessage{Role: RoleUser, Content: []ContentBlock{
+		NewTextBlock("Summarize: "), text, NewDocumentBlock(MediaTypePDF, "JVBERi0=", "scan.pdf"),
+	}}
+	if got, want := msg.ToMessage().Content, "Summarize: "+InlineDocumentText(text.Document, "# Title"); got != want {
+		t.Errorf("ToMessage().Content = %q, want %q", got, want)
+	}
+
+	// Content documents round-trip through JSON.
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ContentBlock
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Document.Source.Content) != 2 {
+		t.Errorf("Expected content blocks to round-trip, got %s", data)
+	}
+}
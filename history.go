@@ -0,0 +1,170 @@
+package llmapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HistoryEditor is optionally implemented by Conversation implementations
+// that allow their history to be edited in place.
+//
+// Every edit is validated with ValidateToolPairing before it is applied.
+// An edit that would break tool_use/tool_result pairing is rejected with a
+// *ToolPairingError and leaves the history unchanged. Index errors are
+// reported with ErrMessageIndex.
+type HistoryEditor interface {
+	// TruncateTo keeps the first n messages and discards the rest.
+	TruncateTo(n int) error
+	// ReplaceMessage replaces the message at index i.
+	ReplaceMessage(i int, msg RichMessage) error
+	// RemoveMessage deletes the message at index i.
+	RemoveMessage(i int) error
+}
+
+// Errors reported by history edits and ValidateToolPairing.
+var (
+	// ErrMessageIndex is returned for an out-of-range message index.
+	ErrMessageIndex = errors.New("message index out of range")
+	// ErrOrphanToolResult means a tool_result has no matching tool_use in
+	// the preceding assistant message.
+	ErrOrphanToolResult = errors.New("tool_result without matching tool_use")
+	// ErrMissingToolResult means an assistant tool_use is not answered by a
+	// tool_result in the following user message.
+	ErrMissingToolResult = errors.New("tool_use without matching tool_result")
+	// ErrDuplicateToolUseID means two tool_use blocks share an ID.
+	ErrDuplicateToolUseID = errors.New("duplicate tool_use ID")
+)
+
+// ToolPairingError describes a tool_use/tool_result pairing violation.
+// Err is one of ErrOrphanToolResult, ErrMissingToolResult or
+// ErrDuplicateToolUseID.
+type ToolPairingError struct {
+	// Index is the index of the offending message.
+	Index int
+	// ToolUseID is the ID of the unpaired block.
+	ToolUseID string
+	Err       error
+}
+
+func (e *ToolPairingError) Error() string {
+	return fmt.Sprintf("message %d: %v (id %q)", e.Index, e.Err, e.ToolUseID)
+}
+
+func (e *ToolPairingError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateToolPairing checks that every tool_use in an assistant message
+// is answered by a tool_result in the next message, and that every
+// tool_result answers a tool_use in the previous message. Tool uses in the
+// final message are allowed to be unanswered, since their results have
+// not been added yet.
+func ValidateToolPairing(msgs []RichMessage) error {
+	seen := make(map[string]bool)
+	for i, msg := range msgs {
+		uses := toolUseIDs(msg)
+		for _, id := range uses {
+			if seen[id] {
+				return &ToolPairingError{Index: i, ToolUseID: id, Err: ErrDuplicateToolUseID}
+			}
+			seen[id] = true
+		}
+
+		var prevUses []string
+		if i > 0 {
+			prevUses = toolUseIDs(msgs[i-1])
+		}
+		results := toolResultIDs(msg)
+		for _, id := range results {
+			if !containsString(prevUses, id) {
+				return &ToolPairingError{Index: i, ToolUseID: id, Err: ErrOrphanToolResult}
+			}
+		}
+
+		if i+1 < len(msgs) {
+			next := toolResultIDs(msgs[i+1])
+			for _, id := range uses {
+				if !containsString(next, id) {
+					return &ToolPairingError{Index: i, ToolUseID: id, Err: ErrMissingToolResult}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func toolUseIDs(msg RichMessage) []string {
+	var ids []string
+	for _, block := range msg.Content {
+		if block.Type == ContentTypeToolUse && block.ToolUse != nil {
+			ids = append(ids, block.ToolUse.ID)
+		}
+	}
+	return ids
+}
+
+func toolResultIDs(msg RichMessage) []string {
+	var ids []string
+	for _, block := range msg.Content {
+		if block.Type == ContentTypeToolResult && block.ToolResult != nil {
+			ids = append(ids, block.ToolResult.ToolUseID)
+		}
+	}
+	return ids
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ==========================================================================
+// Edit Helpers
+// ==========================================================================
+
+// The helpers below implement the HistoryEditor operations on a message
+// slice. They return a new slice and never modify msgs, so implementations
+// can apply the result only when it is valid.
+
+// TruncateHistory returns the first n messages of msgs.
+func TruncateHistory(msgs []RichMessage, n int) ([]RichMessage, error) {
+	if n < 0 || n > len(msgs) {
+		return nil, fmt.Errorf("truncate to %d of %d messages: %w", n, len(msgs), ErrMessageIndex)
+	}
+	out := append([]RichMessage(nil), msgs[:n]...)
+	if err := ValidateToolPairing(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceHistoryMessage returns msgs with the message at index i replaced.
+func ReplaceHistoryMessage(msgs []RichMessage, i int, msg RichMessage) ([]RichMessage, error) {
+	if i < 0 || i >= len(msgs) {
+		return nil, fmt.Errorf("replace message %d of %d: %w", i, len(msgs), ErrMessageIndex)
+	}
+	out := append([]RichMessage(nil), msgs...)
+	out[i] = msg
+	if err := ValidateToolPairing(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveHistoryMessage returns msgs without the message at index i.
+func RemoveHistoryMessage(msgs []RichMessage, i int) ([]RichMessage, error) {
+	if i < 0 || i >= len(msgs) {
+		return nil, fmt.Errorf("remove message %d of %d: %w", i, len(msgs), ErrMessageIndex)
+	}
+	out := make([]RichMessage, 0, len(msgs)-1)
+	out = append(out, msgs[:i]...)
+	out = append(out, msgs[i+1:]...)
+	if err := ValidateToolPairing(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,73 @@
+package llmapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func toolUseMessage(id string) RichMessage {
+	return RichMessage{Role: RoleAssistant, Content: []ContentBlock{
+		NewTextBlock("calling"),
+		{Type: ContentTypeToolUse, ToolUse: &ToolUseContent{ID: id, Name: "t", Input: []byte(`{}`)}},
+	}}
+}
+
+func toolResultMessage(id string) RichMessage {
+	return RichMessage{Role: RoleUser, Content: []ContentBlock{NewToolResultBlock(id, "ok", false)}}
+}
+
+// TestValidateToolPairing tests the tool_use/tool_result invariants.
+func TestValidateToolPairing(t *testing.T) {
+	user := RichMessage{Role: RoleUser, Content: textContent("hi")}
+	tests := []struct {
+		name string
+		msgs []RichMessage
+		want error
+	}{
+		{"Valid", []RichMessage{user, toolUseMessage("a"), toolResultMessage("a")}, nil},
+		{"PendingToolUse", []RichMessage{user, toolUseMessage("a")}, nil},
+		{"Orphan", []RichMessage{user, toolResultMessage("a")}, ErrOrphanToolResult},
+		{"Missing", []RichMessage{user, toolUseMessage("a"), user}, ErrMissingToolResult},
+		{"Duplicate", []RichMessage{toolUseMessage("a"), toolResultMessage("a"), toolUseMessage("a")}, ErrDuplicateToolUseID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateToolPairing(tt.msgs)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestHistoryEditor tests history edits on the mock conversation.
+func TestHistoryEditor(t *testing.T) {
+	conv := newMockConversation("")
+	conv.AddMessage(RoleUser, "hi")
+	conv.AddRichMessage(RoleAssistant, toolUseMessage("a").Content)
+	conv.AddRichMessage(RoleUser, toolResultMessage("a").Content)
+	conv.AddMessage(RoleAssistant, "done")
+	var editor HistoryEditor = conv
+
+	var pairErr *ToolPairingError
+	if err := editor.RemoveMessage(1); !errors.As(err, &pairErr) || pairErr.Index != 1 {
+		t.Errorf("Expected pairing error at message 1 removing tool_use, got %v", err)
+	}
+	if n := len(conv.GetRichMessages()); n != 4 {
+		t.Errorf("Expected rejected edit to leave 4 messages, got %d", n)
+	}
+
+	if err := editor.ReplaceMessage(3, RichMessage{Role: RoleAssistant, Content: textContent("better")}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if got := conv.GetMessages()[3].Content; got != "better" {
+		t.Errorf("Expected replaced message, got '%s'", got)
+	}
+
+	if err := editor.TruncateTo(2); err != nil {
+		t.Errorf("Expected truncation leaving a pending tool_use to be valid: %v", err)
+	}
+	if err := editor.RemoveMessage(5); !errors.Is(err, ErrMessageIndex) {
+		t.Errorf("Expected ErrMessageIndex, got %v", err)
+	}
+}
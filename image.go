@@ -0,0 +1,289 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Errors reported by NewImageBlockFromReader and NewImageBlockFromFile.
+var (
+	// ErrUnsupportedImageType means the image format is not recognized, or
+	// is not accepted by the provider and cannot be converted.
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	// ErrImageTooLarge means the image exceeds the provider's size limit
+	// and cannot be shrunk to fit.
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// jpegQuality is the quality used when re-encoding JPEG images.
+const jpegQuality = 85
+
+// maxResizeAttempts bounds how many times an oversized image is scaled down.
+const maxResizeAttempts = 8
+
+// NewImageBlockFromFile reads an image file and returns it as a base64
+// image block. See NewImageBlockFromReader.
+func NewImageBlockFromFile(path string, caps Capabilities) (ContentBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+	defer f.Close()
+	block, err := NewImageBlockFromReader(f, caps)
+	if err != nil {
+		return ContentBlock{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return block, nil
+}
+
+// NewImageBlockFromReader reads an image and returns it as a base64 image
+// block, with the media type sniffed from the data rather than trusted
+// from a file name.
+//
+// The image is checked against caps: a type missing from a non-empty
+// SupportedImageTypes is re-encoded as PNG or JPEG, and an image larger
+// than MaxImageSize bytes is scaled down until it fits. Only PNG, JPEG and
+// GIF can be decoded for conversion, so other types are passed through
+// unchanged when acceptable and rejected otherwise. Whether the provider
+// supports images at all is not checked.
+func NewImageBlockFromReader(r io.Reader, caps Capabilities) (ContentBlock, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ContentBlock{}, fmt.Errorf("read image: %w", err)
+	}
+	mediaType, err := SniffImageType(data)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+
+	fits := caps.MaxImageSize <= 0 || int64(len(data)) <= caps.MaxImageSize
+	if imageTypeAllowed(caps, mediaType) && fits {
+		return NewImageBlock(mediaType, base64.StdEncoding.EncodeToString(data)), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if !imageTypeAllowed(caps, mediaType) {
+			return ContentBlock{}, fmt.Errorf("%w: %s is not accepted and cannot be converted", ErrUnsupportedImageType, mediaType)
+		}
+		return ContentBlock{}, fmt.Errorf("%w: %d bytes exceeds limit of %d and %s cannot be resized",
+			ErrImageTooLarge, len(data), caps.MaxImageSize, mediaType)
+	}
+	target, err := reencodeType(caps, mediaType)
+	if err != nil {
+		return ContentBlock{}, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		encoded, err := encodeImage(img, target)
+		if err != nil {
+			return ContentBlock{}, err
+		}
+		size := int64(len(encoded))
+		if caps.MaxImageSize <= 0 || size <= caps.MaxImageSize {
+			return NewImageBlock(target, base64.StdEncoding.EncodeToString(encoded)), nil
+		}
+		bounds := img.Bounds()
+		if attempt == maxResizeAttempts || (bounds.Dx() <= 1 && bounds.Dy() <= 1) {
+			return ContentBlock{}, fmt.Errorf("%w: %d bytes exceeds limit of %d after resizing",
+				ErrImageTooLarge, size, caps.MaxImageSize)
+		}
+		// Encoded size is roughly proportional to pixel count; aim a little
+		// below the limit so most images fit on the next attempt.
+		scale := 0.9 * math.Sqrt(float64(caps.MaxImageSize)/float64(size))
+		img = scaleImage(img, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+	}
+}
+
+// SniffImageType returns the media type of image data, detected from its
+// content. It fails with ErrUnsupportedImageType for anything other than
+// PNG, JPEG, GIF or WebP.
+func SniffImageType(data []byte) (MediaType, error) {
+	detected := http.DetectContentType(data)
+	switch mt := MediaType(detected); mt {
+	case MediaTypePNG, MediaTypeJPEG, MediaTypeGIF, MediaTypeWebP:
+		return mt, nil
+	}
+	return "", fmt.Errorf("%w: detected %s", ErrUnsupportedImageType, detected)
+}
+
+// imageTypeAllowed reports whether caps accepts mediaType. An empty
+// SupportedImageTypes accepts every type.
+func imageTypeAllowed(caps Capabilities, mediaType MediaType) bool {
+	return len(caps.SupportedImageTypes) == 0 || containsString(caps.SupportedImageTypes, string(mediaType))
+}
+
+// reencodeType picks the format to re-encode an image as: its own format
+// when accepted and encodable, otherwise PNG or JPEG.
+func reencodeType(caps Capabilities, mediaType MediaType) (MediaType, error) {
+	if (mediaType == MediaTypePNG || mediaType == MediaTypeJPEG) && imageTypeAllowed(caps, mediaType) {
+		return mediaType, nil
+	}
+	for _, mt := range []MediaType{MediaTypePNG, MediaTypeJPEG} {
+		if imageTypeAllowed(caps, mt) {
+			return mt, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is not accepted and no PNG or JPEG fallback is supported", ErrUnsupportedImageType, mediaType)
+}
+
+func encodeImage(img image.Image, mediaType MediaType) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mediaType {
+	case MediaTypePNG:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	case MediaTypeJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case MediaTypeGIF:
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("%w: cannot encode %s", ErrUnsupportedImageType, mediaType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", mediaType, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage resizes img to width x height by averaging the source pixels
+// covered by each destination pixel, which avoids aliasing when shrinking.
+func scaleImage(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := max(y0+1, (y+1)*sh/height)
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := max(x0+1, (x+1)*sw/width)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// ==========================================================================
+// Generated Images
+// ==========================================================================
+
+// imageExtensions maps image media types to file extensions.
+var imageExtensions = map[MediaType]string{
+	MediaTypePNG:  ".png",
+	MediaTypeJPEG: ".jpg",
+	MediaTypeGIF:  ".gif",
+	MediaTypeWebP: ".webp",
+}
+
+// ImageExtension returns the file extension for an image media type,
+// including the leading dot.
+func ImageExtension(mediaType MediaType) (string, error) {
+	ext, ok := imageExtensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("%w: no file extension for %s", ErrUnsupportedImageType, mediaType)
+	}
+	return ext, nil
+}
+
+// SaveImage writes a base64 image to path plus the extension for its
+// media type, and returns the full path written.
+func SaveImage(img *ImageContent, path string) (string, error) {
+	if img.Source.Type != "base64" {
+		return "", fmt.Errorf("image source type %q has no inline data", img.Source.Type)
+	}
+	ext, err := ImageExtension(img.Source.MediaType)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(img.Source.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode image data: %w", err)
+	}
+	path += ext
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SaveImages writes the response's generated images into dir as
+// prefix-1.png, prefix-2.jpg and so on, and returns the paths written.
+func (rr RichResponse) SaveImages(dir, prefix string) ([]string, error) {
+	var paths []string
+	for i, img := range rr.Images() {
+		path, err := SaveImage(img, filepath.Join(dir, fmt.Sprintf("%s-%d", prefix, i+1)))
+		if err != nil {
+			return paths, fmt.Errorf("save image %d: %w", i+1, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// generatedImageText is the text stand-in for an assistant-generated image.
+func generatedImageText(img *ImageContent) string {
+	return fmt.Sprintf("[generated image: %s]", img.Source.MediaType)
+}
+
+// AssistantImagesToText returns msgs with images in assistant messages
+// replaced by text placeholders, for sending history generated by an
+// image-output model to a provider that only accepts images from the
+// user (see NegotiateHistory). msgs is not modified.
+func AssistantImagesToText(msgs []RichMessage) []RichMessage {
+	out := make([]RichMessage, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg
+		if msg.Role != RoleAssistant {
+			continue
+		}
+		var content []ContentBlock
+		for j, block := range msg.Content {
+			if block.Type != ContentTypeImage || block.Image == nil {
+				if content != nil {
+					content = append(content, block)
+				}
+				continue
+			}
+			if content == nil {
+				content = append([]ContentBlock(nil), msg.Content[:j]...)
+			}
+			content = append(content, NewTextBlock(generatedImageText(block.Image)))
+		}
+		if content != nil {
+			out[i].Content = content
+		}
+	}
+	return out
+}
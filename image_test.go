@@ -0,0 +1,229 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// noisyPNG encodes a random-noise image, which compresses poorly.
+func noisyPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestNewImageBlockFromReader tests sniffing, validation and resizing.
+func TestNewImageBlockFromReader(t *testing.T) {
+	t.Run("PassThrough", func(t *testing.T) {
+		data := noisyPNG(t, 8, 8)
+		block, err := NewImageBlockFromReader(bytes.NewReader(data), Capabilities{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if block.Image.Source.MediaType != MediaTypePNG {
+			t.Errorf("Expected sniffed PNG, got %s", block.Image.Source.MediaType)
+		}
+		if block.Image.Source.Data != base64.StdEncoding.EncodeToString(data) {
+			t.Error("Expected data to be passed through unchanged")
+		}
+	})
+
+	t.Run("Downscale", func(t *testing.T) {
+		data := noisyPNG(t, 200, 100)
+		limit := int64(len(data) / 4)
+		block, err := NewImageBlockFromReader(bytes.NewReader(data), Capabilities{MaxImageSize: limit})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		raw, _ := base64.StdEncoding.DecodeString(block.Image.Source.Data)
+		if int64(len(raw)) > limit {
+			t.Errorf("Expected at most %d bytes, got %d", limit, len(raw))
+		}
+		w, h, err := ImageDimensions(block.Image.Source)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if w >= 200 || w-2*h < -1 || w-2*h > 1 {
+			t.Errorf("Expected smaller image with 2:1 aspect, got %dx%d", w, h)
+		}
+	})
+
+	t.Run("Reencode", func(t *testing.T) {
+		img := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White})
+		var buf bytes.Buffer
+		if err := gif.Encode(&buf, img, nil); err != nil {
+			t.Fatalf("encode gif: %v", err)
+		}
+		caps := Capabilities{SupportedImageTypes: []string{"image/jpeg", "image/png"}}
+		block, err := NewImageBlockFromReader(&buf, caps)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if block.Image.Source.MediaType != MediaTypePNG {
+			t.Errorf("Expected GIF re-encoded as PNG, got %s", block.Image.Source.MediaType)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := NewImageBlockFromReader(bytes.NewReader([]byte("not an image at all")), Capabilities{})
+		if !errors.Is(err, ErrUnsupportedImageType) {
+			t.Errorf("Expected ErrUnsupportedImageType, got %v", err)
+		}
+
+		webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+		_, err = NewImageBlockFromReader(bytes.NewReader(webp), Capabilities{SupportedImageTypes: []string{"image/png"}})
+		if !errors.Is(err, ErrUnsupportedImageType) {
+			t.Errorf("Expected ErrUnsupportedImageType for unconvertible WebP, got %v", err)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 " + string(make([]byte, 100)))
+		_, err := NewImageBlockFromReader(bytes.NewReader(webp), Capabilities{MaxImageSize: 10})
+		if !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("Expected ErrImageTooLarge, got %v", err)
+		}
+	})
+}
+
+// TestNewImageBlockFromFile tests loading an image from disk.
+func TestNewImageBlockFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg") // extension is ignored
+	if err := os.WriteFile(path, noisyPNG(t, 4, 4), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	block, err := NewImageBlockFromFile(path, Capabilities{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if block.Image.Source.MediaType != MediaTypePNG {
+		t.Errorf("Expected sniffed PNG, got %s", block.Image.Source.MediaType)
+	}
+	if _, err := NewImageBlockFromFile(filepath.Join(t.TempDir(), "missing.png"), Capabilities{}); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+// TestGeneratedImages tests handling images in assistant responses.
+func TestGeneratedImages(t *testing.T) {
+	png := NewImageBlock(MediaTypePNG, base64.StdEncoding.EncodeToString(noisyPNG(t, 2, 2)))
+	jpg := NewImageBlock(MediaTypeJPEG, base64.StdEncoding.EncodeToString([]byte("jpeg")))
+	resp := RichResponse{Content: []ContentBlock{NewTextBlock("Here you go: "), png, jpg}}
+
+	if images := resp.Images(); len(images) != 2 || images[1].Source.MediaType != MediaTypeJPEG {
+		t.Fatalf("Images() = %+v", images)
+	}
+
+	dir := t.TempDir()
+	paths, err := resp.SaveImages(dir, "out")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "out-1.png"), filepath.Join(dir, "out-2.jpg")}
+	for i, path := range want {
+		if i >= len(paths) || paths[i] != path {
+			t.Errorf("Expected path %s, got %v", path, paths)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+		}
+	}
+	if _, err := SaveImage(&ImageContent{Source: ImageSource{Type: "base64", MediaType: "image/tiff"}}, filepath.Join(dir, "x")); !errors.Is(err, ErrUnsupportedImageType) {
+		t.Errorf("Expected ErrUnsupportedImageType for unknown extension, got %v", err)
+	}
+
+	msg := RichMessage{Role: RoleAssistant, Content: resp.Content}
+	if got := msg.ToMessage().Content; got != "Here you go: [generated image: image/png][generated image: image/jpeg]" {
+		t.Errorf("ToMessage().Content = %q", got)
+	}
+
+	history := []RichMessage{{Role: RoleUser, Content: []ContentBlock{png}}, msg}
+	replay := AssistantImagesToText(history)
+	if replay[0].Content[0].Type != ContentTypeImage {
+		t.Error("Expected user images to be kept")
+	}
+	if len(replay[1].Content) != 3 || replay[1].Content[1].Type != ContentTypeText || replay[1].Content[2].Text != "[generated image: image/jpeg]" {
+		t.Errorf("Expected assistant images as text, got %+v", replay[1].Content)
+	}
+	if history[1].Content[1].Type != ContentTypeImage {
+		t.Error("Expected original history to be unchanged")
+	}
+}
+
+// assistantImageHistory is a history with an image generated by the model.
+func assistantImageHistory(t *testing.T) []RichMessage {
+	return []RichMessage{
+		{Role: RoleUser, Content: textContent("draw a square")},
+		{Role: RoleAssistant, Content: []ContentBlock{NewTextBlock("Here:"), NewImageBlock(MediaTypePNG, pngBase64(t, 4, 4))}},
+	}
+}
+
+// TestAssistantImagesKeptOnReplay tests that history replayed into a
+// provider without image output stays exact, and is adapted on send.
+func TestAssistantImagesKeptOnReplay(t *testing.T) {
+	history := assistantImageHistory(t)
+	textOnly := capsFactory{caps: Capabilities{SupportsImages: true}}
+
+	store, err := NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.Put("chat", &Snapshot{Messages: history})
+	pc, err := ResumePersistentConversation(store, "chat", textOnly)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pc.SetModel("other-model")
+	if err := pc.Err(); err != nil {
+		t.Fatalf("Unexpected persistence error: %v", err)
+	}
+	snap, err := store.Get("chat")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(snap.Messages, history) {
+		t.Errorf("Expected stored images to survive a sync, got %+v", snap.Messages[1].Content)
+	}
+
+	conv := newMockConversation("sys")
+	replayHistory(conv, history)
+	tree := NewConversationTree(conv, Settings{})
+	replayed := tree.Replay(textOnly)
+	if err := tree.Record(replayed); err != nil {
+		t.Errorf("Expected replayed history to match the tree: %v", err)
+	}
+
+	sent, changes, err := NegotiateHistory(replayed.GetRichMessages(), textOnly.caps, NegotiationPolicy{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := sent[1].Content[1]; got.Type != ContentTypeText || got.Text != "[generated image: image/png]" {
+		t.Errorf("Expected the assistant image as text on send, got %+v", got)
+	}
+	if len(changes) != 1 || changes[0].Message != 1 || changes[0].Index != 1 {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+	if _, changes, _ := NegotiateHistory(history, Capabilities{SupportsImages: true, SupportsImageOutput: true}, NegotiationPolicy{}); len(changes) != 0 {
+		t.Errorf("Expected no changes with image output, got %+v", changes)
+	}
+}
@@ -8,6 +8,9 @@ type Sampling struct {
 	TopK        int     // 0 = use default, 1 = deterministic
 	Temperature float64 // 0 = use default
 	TopP        float64 // 0 = use default
+
+	Thinking   *ThinkingConfig // nil = use default; see ResolveThinking
+	ToolChoice *ToolChoice     // nil = use default
 }
 
 // Conversation is the primary interface for LLM interactions.
@@ -66,6 +69,8 @@ type Conversation interface {
 	SetEndpoint(endpoint string)
 
 	// SendRich sends a message with rich content blocks and returns a full response.
+	// Thinking and redacted thinking blocks in the history, including their
+	// signatures, are sent back to the provider unchanged.
 	// This enables multimodal input (images, documents) and captures all response
 	// types (text, thinking, tool use).
 	//
@@ -97,10 +102,43 @@ type Conversation interface {
 // CapabilityProvider is optionally implemented by Conversation implementations
 // to advertise their capabilities.
 type CapabilityProvider interface {
-	// GetCapabilities returns the provider's capabilities.
+	// GetCapabilities returns the provider's capabilities for the current
+	// model, typically looked up in a ModelCatalog such as DefaultCatalog.
 	GetCapabilities() Capabilities
 }
 
+// SystemCacheSetter is optionally implemented by Conversation
+// implementations that support prompt caching of the system prompt.
+type SystemCacheSetter interface {
+	// SetSystemCacheControl marks the system prompt as a cache breakpoint.
+	// Pass nil to stop caching it.
+	SetSystemCacheControl(cc *CacheControl)
+}
+
+// SystemSetter is optionally implemented by Conversation implementations
+// whose system prompt can be changed after creation.
+type SystemSetter interface {
+	// SetSystem replaces the system prompt for subsequent calls.
+	SetSystem(system string)
+}
+
+// ContextGetter is optionally implemented by Conversation implementations
+// that expose the context set with SetContext, so decorators that replace
+// it for a call can restore it afterwards.
+type ContextGetter interface {
+	// Context returns the current context.
+	Context() context.Context
+}
+
+// ToolChoiceSetter is optionally implemented by Conversation
+// implementations that let the caller control tool use. Providers without
+// a native equivalent emulate it with ApplyToolChoice.
+type ToolChoiceSetter interface {
+	// SetToolChoice sets the default tool choice for subsequent calls.
+	// Pass nil to restore the provider default (auto).
+	SetToolChoice(choice *ToolChoice)
+}
+
 // ConversationFactory creates new conversations.
 // Each provider implements this.
 type ConversationFactory interface {
@@ -0,0 +1,361 @@
+package llmapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ==========================================================================
+// Correlation IDs
+// ==========================================================================
+
+// CorrelationIDHeader is the HTTP header providers should use to forward
+// the correlation ID found in the request context.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying the given
+// correlation ID.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by ctx, or
+// an empty string if there is none. Provider implementations should send
+// it in the CorrelationIDHeader of their HTTP requests.
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// NewCorrelationID returns a random 16-byte hex-encoded identifier.
+func NewCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ==========================================================================
+// Logging Decorator
+// ==========================================================================
+
+// LoggingOptions configures a LoggingConversation.
+type LoggingOptions struct {
+	// Level is the level requests and responses are logged at.
+	// Errors are always logged at slog.LevelError.
+	Level slog.Level
+	// LogContent includes message content in the log records. When false,
+	// only metadata (sizes, token counts, stop reasons) is logged.
+	LogContent bool
+	// MaxContentLength truncates logged text to this many bytes. 0 = no limit.
+	MaxContentLength int
+	// Redact, if set, is applied to every logged text payload.
+	Redact func(string) string
+	// NewCorrelationID generates per-call correlation IDs.
+	// Defaults to NewCorrelationID.
+	NewCorrelationID func() string
+}
+
+// LoggingConversation wraps a Conversation and logs every request and
+// response through a slog.Logger. Each call is assigned a correlation ID
+// which is logged and passed to the wrapped conversation's context.
+type LoggingConversation struct {
+	Conversation
+	logger *slog.Logger
+	opts   LoggingOptions
+	ctx    context.Context
+}
+
+// WithLogging wraps conv so that every send is logged to logger.
+// A nil logger uses slog.Default(). The base context is conv's current
+// context if it implements ContextGetter; otherwise set it with
+// SetContext on the decorator, since it is replaced after each call.
+func WithLogging(conv Conversation, logger *slog.Logger, opts LoggingOptions) *LoggingConversation {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.NewCorrelationID == nil {
+		opts.NewCorrelationID = NewCorrelationID
+	}
+	ctx := context.Background()
+	if g, ok := conv.(ContextGetter); ok && g.Context() != nil {
+		ctx = g.Context()
+	}
+	return &LoggingConversation{
+		Conversation: conv,
+		logger:       logger,
+		opts:         opts,
+		ctx:          ctx,
+	}
+}
+
+// Context returns the base context, without a call's correlation ID.
+func (lc *LoggingConversation) Context() context.Context {
+	return lc.ctx
+}
+
+// SetContext sets the base context for subsequent calls. The correlation
+// ID for each call is layered on top of it.
+func (lc *LoggingConversation) SetContext(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	lc.ctx = ctx
+	lc.Conversation.SetContext(ctx)
+}
+
+// begin assigns a correlation ID, installs it on the wrapped conversation's
+// context and logs the outgoing request.
+func (lc *LoggingConversation) begin(method string, content []ContentBlock, sampling Sampling) (string, time.Time) {
+	id := lc.opts.NewCorrelationID()
+	lc.Conversation.SetContext(ContextWithCorrelationID(lc.ctx, id))
+
+	attrs := []slog.Attr{
+		slog.String("correlation_id", id),
+		slog.String("method", method),
+		slog.Int("blocks", len(content)),
+	}
+	if sampling != (Sampling{}) {
+		attrs = append(attrs, slog.Group("sampling",
+			slog.Int("top_k", sampling.TopK),
+			slog.Float64("temperature", sampling.Temperature),
+			slog.Float64("top_p", sampling.TopP),
+		))
+	}
+	if choice := sampling.ToolChoice; choice != nil {
+		attrs = append(attrs, slog.String("tool_choice", choice.String()))
+	}
+	if lc.opts.LogContent && len(content) > 0 {
+		attrs = append(attrs, slog.Any("content", lc.summarizeBlocks(content)))
+	}
+	lc.logger.LogAttrs(lc.ctx, lc.opts.Level, "llm request", attrs...)
+	return id, time.Now()
+}
+
+// end logs the outcome of a call and restores the base context.
+func (lc *LoggingConversation) end(id, method string, start time.Time, resp *RichResponse, err error) {
+	lc.Conversation.SetContext(lc.ctx)
+
+	attrs := []slog.Attr{
+		slog.String("correlation_id", id),
+		slog.String("method", method),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		lc.logger.LogAttrs(lc.ctx, slog.LevelError, "llm error", attrs...)
+		return
+	}
+	attrs = append(attrs,
+		slog.String("stop_reason", resp.StopReason),
+		slog.Int("input_tokens", resp.InputTokens),
+		slog.Int("output_tokens", resp.OutputTokens),
+	)
+	if meta := resp.Metadata; meta != nil {
+		if meta.ResponseID != "" {
+			attrs = append(attrs, slog.String("response_id", meta.ResponseID))
+		}
+		if meta.ProviderRequestID != "" {
+			attrs = append(attrs, slog.String("provider_request_id", meta.ProviderRequestID))
+		}
+		if meta.Model != "" {
+			attrs = append(attrs, slog.String("served_model", meta.Model))
+		}
+	}
+	if lc.opts.LogContent {
+		attrs = append(attrs, slog.Any("content", lc.summarizeBlocks(resp.Content)))
+	}
+	lc.logger.LogAttrs(lc.ctx, lc.opts.Level, "llm response", attrs...)
+}
+
+// textContent wraps text in a single text block, or returns nil if empty.
+func textContent(text string) []ContentBlock {
+	if text == "" {
+		return nil
+	}
+	return []ContentBlock{NewTextBlock(text)}
+}
+
+func (lc *LoggingConversation) sendText(method, text string, sampling Sampling,
+	send func() (string, string, int, int, error)) (string, string, int, int, error) {
+	id, start := lc.begin(method, textContent(text), sampling)
+	reply, stopReason, in, out, err := send()
+	lc.end(id, method, start, &RichResponse{
+		Content:      textContent(reply),
+		StopReason:   stopReason,
+		InputTokens:  in,
+		OutputTokens: out,
+	}, err)
+	return reply, stopReason, in, out, err
+}
+
+// Send logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	return lc.sendText("Send", text, sampling, func() (string, string, int, int, error) {
+		return lc.Conversation.Send(text, sampling)
+	})
+}
+
+// SendStreaming logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return lc.sendText("SendStreaming", text, sampling, func() (string, string, int, int, error) {
+		return lc.Conversation.SendStreaming(text, sampling, callback)
+	})
+}
+
+// SendUntilDone logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	return lc.sendText("SendUntilDone", text, sampling, func() (string, string, int, int, error) {
+		return lc.Conversation.SendUntilDone(text, sampling)
+	})
+}
+
+// SendStreamingUntilDone logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return lc.sendText("SendStreamingUntilDone", text, sampling, func() (string, string, int, int, error) {
+		return lc.Conversation.SendStreamingUntilDone(text, sampling, callback)
+	})
+}
+
+// SendRich logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	id, start := lc.begin("SendRich", content, sampling)
+	resp, err := lc.Conversation.SendRich(content, sampling)
+	lc.end(id, "SendRich", start, resp, err)
+	return resp, err
+}
+
+// SendRichStreaming logs and forwards to the wrapped conversation.
+func (lc *LoggingConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	id, start := lc.begin("SendRichStreaming", content, sampling)
+	resp, err := lc.Conversation.SendRichStreaming(content, sampling, callback)
+	lc.end(id, "SendRichStreaming", start, resp, err)
+	return resp, err
+}
+
+// ==========================================================================
+// Content Summaries
+// ==========================================================================
+
+func (lc *LoggingConversation) summarizeBlocks(blocks []ContentBlock) []string {
+	out := make([]string, len(blocks))
+	for i, block := range blocks {
+		out[i] = lc.summarizeBlock(block)
+	}
+	return out
+}
+
+// summarizeBlock renders a content block for logging. Binary payloads are
+// never logged; images and documents are summarized by media type and size.
+func (lc *LoggingConversation) summarizeBlock(block ContentBlock) string {
+	switch block.Type {
+	case ContentTypeText:
+		return "text: " + lc.clip(block.Text)
+	case ContentTypeImage:
+		if block.Image == nil {
+			break
+		}
+		return "image: " + summarizeSource(block.Image.Source.Type, block.Image.Source.MediaType,
+			block.Image.Source.Data, block.Image.Source.URL)
+	case ContentTypeAudio:
+		if block.Audio == nil {
+			break
+		}
+		summary := "audio: " + summarizeSource(block.Audio.Source.Type, block.Audio.Source.MediaType,
+			block.Audio.Source.Data, block.Audio.Source.URL)
+		if block.Audio.Duration > 0 {
+			summary += " " + block.Audio.Duration.String()
+		}
+		return summary
+	case ContentTypeDocument:
+		if block.Document == nil {
+			break
+		}
+		switch src := block.Document.Source; src.Type {
+		case "text":
+			return fmt.Sprintf("document: %s text %d bytes", src.MediaType, len(src.Data))
+		case "content":
+			return fmt.Sprintf("document: content %d blocks", len(src.Content))
+		}
+		return "document: " + summarizeSource(block.Document.Source.Type, block.Document.Source.MediaType,
+			block.Document.Source.Data, "")
+	case ContentTypeToolUse:
+		if block.ToolUse == nil {
+			break
+		}
+		return fmt.Sprintf("tool_use: %s(%s) id=%s", block.ToolUse.Name,
+			lc.clip(string(block.ToolUse.Input)), block.ToolUse.ID)
+	case ContentTypeToolResult:
+		if block.ToolResult == nil {
+			break
+		}
+		if len(block.ToolResult.Blocks) > 0 {
+			return fmt.Sprintf("tool_result: id=%s error=%t [%s]", block.ToolResult.ToolUseID,
+				block.ToolResult.IsError, strings.Join(lc.summarizeBlocks(block.ToolResult.Blocks), ", "))
+		}
+		return fmt.Sprintf("tool_result: id=%s error=%t %s", block.ToolResult.ToolUseID,
+			block.ToolResult.IsError, lc.clip(block.ToolResult.Content))
+	case ContentTypeServerToolUse:
+		if block.ServerToolUse == nil {
+			break
+		}
+		return fmt.Sprintf("server_tool_use: %s(%s) id=%s", block.ServerToolUse.Name,
+			lc.clip(string(block.ServerToolUse.Input)), block.ServerToolUse.ID)
+	case ContentTypeWebSearchToolResult, ContentTypeCodeExecutionToolResult:
+		if block.ServerToolResult == nil {
+			break
+		}
+		return fmt.Sprintf("%s: id=%s %d bytes", block.Type, block.ServerToolResult.ToolUseID,
+			len(block.ServerToolResult.Content))
+	case ContentTypeThinking:
+		if block.Thinking == nil {
+			break
+		}
+		return "thinking: " + lc.clip(block.Thinking.Thinking)
+	case ContentTypeRedactedThinking:
+		if block.RedactedThinking == nil {
+			break
+		}
+		return fmt.Sprintf("redacted_thinking: %d bytes", len(block.RedactedThinking.Data))
+	}
+	return string(block.Type)
+}
+
+// summarizeSource describes a base64 or URL source without its payload.
+func summarizeSource(sourceType string, mediaType MediaType, data, url string) string {
+	if sourceType == "url" {
+		return fmt.Sprintf("%s url=%s", mediaType, url)
+	}
+	// Approximate decoded size from the base64 length.
+	return fmt.Sprintf("%s %s %d bytes", mediaType, sourceType, len(data)*3/4)
+}
+
+// clip redacts and truncates text according to the logging options.
+func (lc *LoggingConversation) clip(text string) string {
+	if lc.opts.Redact != nil {
+		text = lc.opts.Redact(text)
+	}
+	if n := lc.opts.MaxContentLength; n > 0 && len(text) > n {
+		// Back up so a multi-byte character is not split.
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		return fmt.Sprintf("%s... (%d bytes)", text[:n], len(text))
+	}
+	return text
+}
@@ -0,0 +1,140 @@
+package llmapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestLoggingConversation tests request/response logging and correlation IDs.
+func TestLoggingConversation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	mock := newMockConversation("system")
+	conv := WithLogging(mock, logger, LoggingOptions{
+		Level:            slog.LevelInfo,
+		LogContent:       true,
+		MaxContentLength: 8,
+		NewCorrelationID: func() string { return "corr-1" },
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		buf.Reset()
+		reply, _, _, _, err := conv.Send("hello there world", Sampling{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if reply != "echo: hello there world" {
+			t.Errorf("Expected echoed reply, got '%s'", reply)
+		}
+		if got := CorrelationIDFromContext(mock.lastCtx); got != "corr-1" {
+			t.Errorf("Expected correlation ID 'corr-1' in context, got '%s'", got)
+		}
+		out := buf.String()
+		if !strings.Contains(out, "llm request") || !strings.Contains(out, "llm response") {
+			t.Errorf("Expected request and response records, got:\n%s", out)
+		}
+		if !strings.Contains(out, "correlation_id=corr-1") {
+			t.Errorf("Expected correlation ID in log, got:\n%s", out)
+		}
+		if strings.Contains(out, "hello there world") {
+			t.Errorf("Expected content to be truncated, got:\n%s", out)
+		}
+	})
+
+	t.Run("ImageSummarized", func(t *testing.T) {
+		buf.Reset()
+		data := strings.Repeat("A", 400)
+		_, err := conv.SendRich([]ContentBlock{NewImageBlock(MediaTypePNG, data)}, Sampling{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		out := buf.String()
+		if strings.Contains(out, data) {
+			t.Error("Expected base64 image data to be omitted from log")
+		}
+		if !strings.Contains(out, "image/png base64 300 bytes") {
+			t.Errorf("Expected image summary, got:\n%s", out)
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		buf.Reset()
+		mock.replies = []*RichResponse{{
+			Content:  textContent("ok"),
+			Metadata: &Metadata{ResponseID: "msg_1", ProviderRequestID: "req_1", Model: "model-2025"},
+		}}
+		if _, err := conv.SendRich(textContent("hi"), Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		out := buf.String()
+		for _, want := range []string{"response_id=msg_1", "provider_request_id=req_1", "served_model=model-2025"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("Expected %q in log, got:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("RuneBoundary", func(t *testing.T) {
+		buf.Reset()
+		// The two-byte "ö" spans bytes 7 and 8, across the 8 byte limit.
+		if _, err := conv.SendRich(textContent("hello wörld"), Sampling{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out := buf.String(); !strings.Contains(out, `text: hello w... (12 bytes)`) {
+			t.Errorf("Expected text clipped before the split character, got:\n%s", out)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		buf.Reset()
+		mock.err = errors.New("boom")
+		defer func() { mock.err = nil }()
+		if _, err := conv.SendRich(textContent("hi"), Sampling{}); err == nil {
+			t.Fatal("Expected error")
+		}
+		if !strings.Contains(buf.String(), "level=ERROR") {
+			t.Errorf("Expected error record, got:\n%s", buf.String())
+		}
+	})
+}
+
+// TestLoggingContextRestored tests that a context set before wrapping
+// survives logged calls and carries the correlation ID during them.
+func TestLoggingContextRestored(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	mock := newMockConversation("")
+	mock.SetContext(ctx)
+	conv := WithLogging(mock, slog.New(slog.NewTextHandler(io.Discard, nil)), LoggingOptions{
+		NewCorrelationID: func() string { return "corr-2" },
+	})
+
+	if _, err := conv.SendRich(textContent("hi"), Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := mock.lastCtx.Value(key{}); got != "caller" || CorrelationIDFromContext(mock.lastCtx) != "corr-2" {
+		t.Errorf("Expected the caller's context with a correlation ID during the call, got %v", mock.lastCtx)
+	}
+	if mock.ctx != ctx {
+		t.Errorf("Expected the caller's context restored, got %v", mock.ctx)
+	}
+}
+
+// TestCorrelationIDContext tests the correlation ID context helpers.
+func TestCorrelationIDContext(t *testing.T) {
+	if id := CorrelationIDFromContext(nil); id != "" {
+		t.Errorf("Expected empty ID from nil context, got '%s'", id)
+	}
+	ctx := ContextWithCorrelationID(nil, "abc")
+	if id := CorrelationIDFromContext(ctx); id != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", id)
+	}
+	if a, b := NewCorrelationID(), NewCorrelationID(); a == b || len(a) != 32 {
+		t.Errorf("Expected distinct 32-char IDs, got '%s' and '%s'", a, b)
+	}
+}
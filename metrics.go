@@ -0,0 +1,438 @@
+package llmapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================================================
+// Observations and Collectors
+// ==========================================================================
+
+// CallObservation describes a single completed call through a
+// MetricsConversation.
+type CallObservation struct {
+	Provider Provider
+	Model    string
+	Method   string
+
+	Latency time.Duration
+	// TimeToFirstToken is the delay before the first streamed text arrived.
+	// Zero for non-streaming calls.
+	TimeToFirstToken time.Duration
+
+	InputTokens  int
+	OutputTokens int
+	ToolCalls    int
+	// Continuations counts the extra max_tokens continuation requests made
+	// by SendUntilDone and SendStreamingUntilDone.
+	Continuations int
+
+	// ErrorType is empty on success, otherwise a short classification of the
+	// error (see ClassifyError).
+	ErrorType string
+}
+
+// MetricsCollector receives observations from a MetricsConversation.
+type MetricsCollector interface {
+	Observe(obs CallObservation)
+}
+
+// MetricsExporter writes collected metrics in the Prometheus text
+// exposition format.
+type MetricsExporter interface {
+	WriteMetrics(w io.Writer) error
+}
+
+// MetricsHandler returns an http.Handler serving the exporter's metrics,
+// suitable for mounting at /metrics.
+func MetricsHandler(exporter MetricsExporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := exporter.WriteMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ClassifyError maps an error to a short label for the errors metric,
+// recognizing this package's error types.
+func ClassifyError(err error) string {
+	var (
+		budget      *BudgetExceededError
+		overflow    *ContextOverflowError
+		unsupported *UnsupportedContentError
+		pairing     *ToolPairingError
+		serverTool  *ServerToolError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &budget):
+		return "budget_exceeded"
+	case errors.As(err, &overflow):
+		return "context_overflow"
+	case errors.As(err, &unsupported):
+		return "unsupported_content"
+	case errors.As(err, &pairing):
+		return "tool_pairing"
+	case errors.As(err, &serverTool):
+		return "server_tool"
+	case errors.Is(err, ErrUnsupportedImageType), errors.Is(err, ErrUnsupportedAudioType),
+		errors.Is(err, ErrUnsupportedDocumentType):
+		return "unsupported_media"
+	case errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrAudioTooLarge):
+		return "media_too_large"
+	case errors.Is(err, ErrUnknownTool):
+		return "unknown_tool"
+	case errors.Is(err, ErrConversationNotFound):
+		return "not_found"
+	default:
+		return "other"
+	}
+}
+
+// ==========================================================================
+// In-memory Registry
+// ==========================================================================
+
+// DefaultLatencyBuckets are the histogram buckets, in seconds, used for
+// latency and time-to-first-token.
+var DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Metrics is an in-memory MetricsCollector and MetricsExporter. All metric
+// names are prefixed with the namespace given to NewMetrics.
+type Metrics struct {
+	mu       sync.Mutex
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string // "counter" or "histogram"
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value  float64  // counter value
+	counts []uint64 // cumulative histogram bucket counts
+	sum    float64
+	count  uint64
+}
+
+// NewMetrics creates an empty registry. namespace defaults to "llmapi".
+func NewMetrics(namespace string) *Metrics {
+	if namespace == "" {
+		namespace = "llmapi"
+	}
+	m := &Metrics{byName: make(map[string]*metricFamily)}
+	m.add(namespace, "requests_total", "Total LLM requests.", "counter", nil)
+	m.add(namespace, "errors_total", "Total failed LLM requests by error type.", "counter", nil)
+	m.add(namespace, "input_tokens_total", "Total input tokens consumed.", "counter", nil)
+	m.add(namespace, "output_tokens_total", "Total output tokens generated.", "counter", nil)
+	m.add(namespace, "tool_calls_total", "Total tool calls requested by the model.", "counter", nil)
+	m.add(namespace, "continuations_total", "Total max_tokens continuation requests.", "counter", nil)
+	m.add(namespace, "request_duration_seconds", "LLM request latency.", "histogram", DefaultLatencyBuckets)
+	m.add(namespace, "time_to_first_token_seconds", "Delay before the first streamed token.", "histogram", DefaultLatencyBuckets)
+	return m
+}
+
+func (m *Metrics) add(namespace, name, help, kind string, buckets []float64) {
+	f := &metricFamily{
+		name:    namespace + "_" + name,
+		help:    help,
+		kind:    kind,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	m.families = append(m.families, f)
+	m.byName[name] = f
+}
+
+func (f *metricFamily) get(labels string) *metricSeries {
+	s, ok := f.series[labels]
+	if !ok {
+		s = &metricSeries{counts: make([]uint64, len(f.buckets))}
+		f.series[labels] = s
+	}
+	return s
+}
+
+func (f *metricFamily) inc(labels string, v float64) {
+	f.get(labels).value += v
+}
+
+func (f *metricFamily) observe(labels string, v float64) {
+	s := f.get(labels)
+	for i, b := range f.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Observe records a call observation.
+func (m *Metrics) Observe(obs CallObservation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := formatLabels("provider", string(obs.Provider), "model", obs.Model)
+	m.byName["requests_total"].inc(labels, 1)
+	if obs.ErrorType != "" {
+		m.byName["errors_total"].inc(formatLabels("provider", string(obs.Provider),
+			"model", obs.Model, "type", obs.ErrorType), 1)
+	}
+	m.byName["input_tokens_total"].inc(labels, float64(obs.InputTokens))
+	m.byName["output_tokens_total"].inc(labels, float64(obs.OutputTokens))
+	m.byName["tool_calls_total"].inc(labels, float64(obs.ToolCalls))
+	m.byName["continuations_total"].inc(labels, float64(obs.Continuations))
+	m.byName["request_duration_seconds"].observe(labels, obs.Latency.Seconds())
+	if obs.TimeToFirstToken > 0 {
+		m.byName["time_to_first_token_seconds"].observe(labels, obs.TimeToFirstToken.Seconds())
+	}
+}
+
+// WriteMetrics writes all metrics in the Prometheus text format.
+func (m *Metrics) WriteMetrics(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, labels := range keys {
+			s := f.series[labels]
+			if f.kind == "counter" {
+				fmt.Fprintf(&b, "%s{%s} %s\n", f.name, labels, formatFloat(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", f.name, labels, formatFloat(bound), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", f.name, labels, s.count)
+			fmt.Fprintf(&b, "%s_sum{%s} %s\n", f.name, labels, formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", f.name, labels, s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelEscaper escapes label values as the Prometheus text format
+// requires; everything else, including non-ASCII text, is written as is.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders alternating name/value pairs as a label set.
+func formatLabels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ==========================================================================
+// Metrics Decorator
+// ==========================================================================
+
+// MetricsConversation wraps a Conversation and reports a CallObservation
+// to its collector after every send.
+//
+// SendUntilDone and SendStreamingUntilDone delegate to the wrapped
+// conversation; continuations are counted from the assistant messages the
+// call added to the history. The stop reasons of the individual requests
+// are not visible to the decorator, so a provider that appends each
+// continuation to the same assistant message reports no continuations.
+type MetricsConversation struct {
+	Conversation
+	collector MetricsCollector
+	provider  Provider
+	model     string
+}
+
+// WithMetrics wraps conv, labelling its observations with provider and model.
+func WithMetrics(conv Conversation, collector MetricsCollector, provider Provider, model string) *MetricsConversation {
+	return &MetricsConversation{
+		Conversation: conv,
+		collector:    collector,
+		provider:     provider,
+		model:        model,
+	}
+}
+
+// SetModel changes the model and the model label used for observations.
+func (mc *MetricsConversation) SetModel(model string) {
+	mc.model = model
+	mc.Conversation.SetModel(model)
+}
+
+func (mc *MetricsConversation) observe(method string, start time.Time, firstToken time.Time,
+	resp *RichResponse, continuations int, err error) {
+	obs := CallObservation{
+		Provider:      mc.provider,
+		Model:         mc.model,
+		Method:        method,
+		Latency:       time.Since(start),
+		Continuations: continuations,
+		ErrorType:     ClassifyError(err),
+	}
+	if !firstToken.IsZero() {
+		obs.TimeToFirstToken = firstToken.Sub(start)
+	}
+	if resp != nil {
+		obs.InputTokens = resp.InputTokens
+		obs.OutputTokens = resp.OutputTokens
+		obs.ToolCalls = len(resp.ToolUses())
+	}
+	mc.collector.Observe(obs)
+}
+
+// timeCallback wraps callback to record when the first text arrives.
+func timeCallback(callback StreamCallback, first *time.Time) StreamCallback {
+	return func(text string, done bool) {
+		if first.IsZero() && text != "" {
+			*first = time.Now()
+		}
+		if callback != nil {
+			callback(text, done)
+		}
+	}
+}
+
+// Send forwards to the wrapped conversation and records the call.
+func (mc *MetricsConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	start := time.Now()
+	reply, stopReason, in, out, err := mc.Conversation.Send(text, sampling)
+	mc.observe("Send", start, time.Time{}, &RichResponse{InputTokens: in, OutputTokens: out}, 0, err)
+	return reply, stopReason, in, out, err
+}
+
+// SendStreaming forwards to the wrapped conversation and records the call.
+func (mc *MetricsConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	var first time.Time
+	start := time.Now()
+	reply, stopReason, in, out, err := mc.Conversation.SendStreaming(text, sampling, timeCallback(callback, &first))
+	mc.observe("SendStreaming", start, first, &RichResponse{InputTokens: in, OutputTokens: out}, 0, err)
+	return reply, stopReason, in, out, err
+}
+
+// continuationsSince counts the continuations of an auto-continued call
+// from the assistant messages added to the history since it held n
+// messages.
+func (mc *MetricsConversation) continuationsSince(n int) int {
+	msgs := mc.Conversation.GetRichMessages()
+	turns := 0
+	for _, msg := range msgs[min(n, len(msgs)):] {
+		if msg.Role == RoleAssistant {
+			turns++
+		}
+	}
+	return max(turns-1, 0)
+}
+
+// SendUntilDone forwards to the wrapped conversation's SendUntilDone,
+// recording the number of continuations.
+func (mc *MetricsConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	n := len(mc.Conversation.GetRichMessages())
+	start := time.Now()
+	reply, stopReason, in, out, err := mc.Conversation.SendUntilDone(text, sampling)
+	mc.observe("SendUntilDone", start, time.Time{}, &RichResponse{InputTokens: in, OutputTokens: out},
+		mc.continuationsSince(n), err)
+	return reply, stopReason, in, out, err
+}
+
+// SendStreamingUntilDone is the streaming counterpart of SendUntilDone.
+func (mc *MetricsConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	var first time.Time
+	n := len(mc.Conversation.GetRichMessages())
+	start := time.Now()
+	reply, stopReason, in, out, err := mc.Conversation.SendStreamingUntilDone(text, sampling, timeCallback(callback, &first))
+	mc.observe("SendStreamingUntilDone", start, first, &RichResponse{InputTokens: in, OutputTokens: out},
+		mc.continuationsSince(n), err)
+	return reply, stopReason, in, out, err
+}
+
+// SendRich forwards to the wrapped conversation and records the call.
+func (mc *MetricsConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	start := time.Now()
+	resp, err := mc.Conversation.SendRich(content, sampling)
+	mc.observe("SendRich", start, time.Time{}, resp, 0, err)
+	return resp, err
+}
+
+// SendRichStreaming forwards to the wrapped conversation and records the call.
+func (mc *MetricsConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	var first time.Time
+	start := time.Now()
+	resp, err := mc.Conversation.SendRichStreaming(content, sampling, timeCallback(callback, &first))
+	mc.observe("SendRichStreaming", start, first, resp, 0, err)
+	return resp, err
+}
+
+// ==========================================================================
+// Response Metadata Timing
+// ==========================================================================
+
+// CallTimer measures the latency and time to first token of one provider
+// call, so every provider fills Metadata timings the same way.
+//
+//	timer := StartCallTimer()
+//	... stream with timer.Callback(callback) ...
+//	timer.Fill(resp.Metadata)
+type CallTimer struct {
+	start time.Time
+	first time.Time
+}
+
+// StartCallTimer starts timing a call. Call it just before sending the
+// request.
+func StartCallTimer() *CallTimer {
+	return &CallTimer{start: time.Now()}
+}
+
+// Callback wraps callback to record when the first text arrives.
+func (ct *CallTimer) Callback(callback StreamCallback) StreamCallback {
+	return timeCallback(callback, &ct.first)
+}
+
+// Fill sets meta's Latency to the time elapsed since the timer started,
+// and TimeToFirstToken if streamed text has arrived.
+func (ct *CallTimer) Fill(meta *Metadata) {
+	if meta == nil {
+		return
+	}
+	meta.Latency = time.Since(ct.start)
+	if !ct.first.IsZero() {
+		meta.TimeToFirstToken = ct.first.Sub(ct.start)
+	}
+}
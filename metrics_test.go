@@ -0,0 +1,135 @@
+package llmapi
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricsConversation tests that calls are observed and exported.
+func TestMetricsConversation(t *testing.T) {
+	metrics := NewMetrics("")
+	mock := newMockConversation("system")
+	mock.replies = []*RichResponse{
+		{Content: textContent("part one "), StopReason: "max_tokens", InputTokens: 10, OutputTokens: 5},
+		{Content: textContent("part two"), StopReason: "end_turn", InputTokens: 12, OutputTokens: 3},
+		{
+			Content: []ContentBlock{{
+				Type:    ContentTypeToolUse,
+				ToolUse: &ToolUseContent{ID: "t1", Name: "lookup", Input: []byte(`{}`)},
+			}},
+			StopReason:   "tool_use",
+			InputTokens:  7,
+			OutputTokens: 2,
+		},
+	}
+	conv := WithMetrics(mock, metrics, ProviderAnthropic, "model-a")
+
+	reply, stop, in, out, err := conv.SendUntilDone("hi", Sampling{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reply != "part one part two" || stop != "end_turn" || in != 22 || out != 8 {
+		t.Errorf("Unexpected result: %q %q %d %d", reply, stop, in, out)
+	}
+	if _, err := conv.SendRich(textContent("tool please"), Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, _, _, err := conv.SendStreaming("stream", Sampling{}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mock.err = context.DeadlineExceeded
+	conv.SendRich(textContent("fail"), Sampling{})
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out2 := b.String()
+	labels := `provider="anthropic",model="model-a"`
+	for _, want := range []string{
+		fmt.Sprintf("llmapi_requests_total{%s} 4", labels),
+		fmt.Sprintf("llmapi_errors_total{%s,type=\"timeout\"} 1", labels),
+		fmt.Sprintf("llmapi_input_tokens_total{%s} 31", labels),
+		fmt.Sprintf("llmapi_continuations_total{%s} 1", labels),
+		fmt.Sprintf("llmapi_tool_calls_total{%s} 1", labels),
+		fmt.Sprintf("llmapi_request_duration_seconds_count{%s} 4", labels),
+		fmt.Sprintf("llmapi_time_to_first_token_seconds_count{%s} 1", labels),
+		"# TYPE llmapi_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(out2, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, out2)
+		}
+	}
+}
+
+// TestMetricsLabelsAndErrors tests label escaping and error classification.
+func TestMetricsLabelsAndErrors(t *testing.T) {
+	if got, want := formatLabels("model", "modèle \"x\"\\\n"), `model="modèle \"x\"\\\n"`; got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+
+	tests := map[string]error{
+		"budget_exceeded":     fmt.Errorf("send: %w", &BudgetExceededError{Budget: "b"}),
+		"context_overflow":    &ContextOverflowError{},
+		"unsupported_content": &UnsupportedContentError{},
+		"unsupported_media":   fmt.Errorf("load: %w", ErrUnsupportedAudioType),
+		"unknown_tool":        fmt.Errorf("tool choice: %w", ErrUnknownTool),
+		"timeout":             context.DeadlineExceeded,
+		"other":               fmt.Errorf("boom"),
+	}
+	for want, err := range tests {
+		if got := ClassifyError(err); got != want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+// TestMetricsHandler tests the /metrics HTTP handler.
+func TestMetricsHandler(t *testing.T) {
+	metrics := NewMetrics("test")
+	metrics.Observe(CallObservation{Provider: ProviderNovelAI, Model: "m", InputTokens: 4})
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got '%s'", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `test_input_tokens_total{provider="novelai",model="m"} 4`) {
+		t.Errorf("Unexpected body:\n%s", rec.Body.String())
+	}
+}
+
+// TestCallTimer tests filling response metadata timings.
+func TestCallTimer(t *testing.T) {
+	timer := StartCallTimer()
+	var got []string
+	cb := timer.Callback(func(text string, done bool) { got = append(got, text) })
+	time.Sleep(2 * time.Millisecond)
+	cb("", false)
+	cb("hi", false)
+	time.Sleep(2 * time.Millisecond)
+	cb("", true)
+
+	var meta Metadata
+	timer.Fill(&meta)
+	if len(got) != 3 {
+		t.Errorf("Expected callback to be forwarded 3 times, got %d", len(got))
+	}
+	if meta.TimeToFirstToken < 2*time.Millisecond {
+		t.Errorf("Expected time to first token of at least 2ms, got %v", meta.TimeToFirstToken)
+	}
+	if meta.Latency < meta.TimeToFirstToken+2*time.Millisecond {
+		t.Errorf("Expected latency to exceed time to first token, got %v and %v", meta.Latency, meta.TimeToFirstToken)
+	}
+
+	var unstreamed Metadata
+	StartCallTimer().Fill(&unstreamed)
+	if unstreamed.TimeToFirstToken != 0 {
+		t.Errorf("Expected no time to first token without streaming, got %v", unstreamed.TimeToFirstToken)
+	}
+	timer.Fill(nil)
+}
@@ -0,0 +1,243 @@
+package llmapi
+
+import (
+	"context"
+	"strings"
+)
+
+// mockConversation is an in-memory Conversation used by the decorator tests.
+// Each send echoes the last user text back (or returns the queued replies in
+// order) and records the sampling and context it was called with.
+type mockConversation struct {
+	system   string
+	model    string
+	endpoint string
+	ctx      context.Context
+	tools    []ToolDefinition
+	messages []RichMessage
+	usage    Usage
+
+	// replies, if non-empty, are returned in order instead of echoing.
+	replies []*RichResponse
+	// err, if set, is returned from every send.
+	err error
+
+	maxTokens   int
+	toolChoice  *ToolChoice
+	systemCache *CacheControl
+
+	calls         int
+	lastSampling  Sampling
+	lastCtx       context.Context
+	lastMaxTokens int
+}
+
+func newMockConversation(system string) *mockConversation {
+	return &mockConversation{system: system, model: "mock-model"}
+}
+
+// mockFactory is a ConversationFactory producing mockConversations.
+type mockFactory struct{}
+
+func (mockFactory) NewConversation(system string) Conversation {
+	return newMockConversation(system)
+}
+
+func (m *mockConversation) respond(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	m.calls++
+	m.lastSampling = sampling
+	m.lastCtx = m.ctx
+	m.lastMaxTokens = m.maxTokens
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(content) > 0 {
+		m.messages = append(m.messages, RichMessage{Role: RoleUser, Content: content})
+	}
+
+	var resp *RichResponse
+	if len(m.replies) > 0 {
+		resp, m.replies = m.replies[0], m.replies[1:]
+	} else {
+		text := RichMessage{Role: RoleUser, Content: content}.ToMessage().Content
+		resp = &RichResponse{
+			Content:      []ContentBlock{NewTextBlock("echo: " + text)},
+			StopReason:   "end_turn",
+			InputTokens:  len(strings.Fields(text)) + 1,
+			OutputTokens: len(strings.Fields(text)) + 1,
+		}
+	}
+
+	m.messages = append(m.messages, RichMessage{Role: RoleAssistant, Content: resp.Content})
+	m.usage.InputTokens += resp.InputTokens
+	m.usage.OutputTokens += resp.OutputTokens
+	return resp, nil
+}
+
+func (m *mockConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	resp, err := m.respond(textContent(text), sampling)
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	return resp.Text(), resp.StopReason, resp.InputTokens, resp.OutputTokens, nil
+}
+
+func (m *mockConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	reply, stop, in, out, err := m.Send(text, sampling)
+	if err == nil && callback != nil {
+		callback(reply, false)
+		callback("", true)
+	}
+	return reply, stop, in, out, err
+}
+
+func (m *mockConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	var reply string
+	var in, out int
+	for {
+		r, stop, i, o, err := m.Send(text, sampling)
+		if err != nil {
+			return reply, stop, in, out, err
+		}
+		reply += r
+		in += i
+		out += o
+		if stop != "max_tokens" {
+			return reply, stop, in, out, nil
+		}
+		text = ""
+	}
+}
+
+func (m *mockConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	reply, stop, in, out, err := m.SendUntilDone(text, sampling)
+	if err == nil && callback != nil {
+		callback(reply, false)
+		callback("", true)
+	}
+	return reply, stop, in, out, err
+}
+
+func (m *mockConversation) AddMessage(role Role, content string) {
+	m.AddRichMessage(role, []ContentBlock{NewTextBlock(content)})
+}
+
+func (m *mockConversation) GetMessages() []Message {
+	msgs := make([]Message, len(m.messages))
+	for i, rm := range m.messages {
+		msgs[i] = rm.ToMessage()
+	}
+	return msgs
+}
+
+func (m *mockConversation) GetUsage() Usage                        { return m.usage }
+func (m *mockConversation) GetSystem() string                      { return m.system }
+func (m *mockConversation) SetSystem(system string)                { m.system = system }
+func (m *mockConversation) Clear()                                 { m.messages = nil }
+func (m *mockConversation) SetContext(ctx context.Context)         { m.ctx = ctx }
+func (m *mockConversation) Context() context.Context               { return m.ctx }
+func (m *mockConversation) SetModel(model string)                  { m.model = model }
+func (m *mockConversation) SetEndpoint(endpoint string)            { m.endpoint = endpoint }
+func (m *mockConversation) SetMaxTokens(n int)                     { m.maxTokens = n }
+func (m *mockConversation) SetTools(tools []ToolDefinition)        { m.tools = tools }
+func (m *mockConversation) GetTools() []ToolDefinition             { return m.tools }
+func (m *mockConversation) SetToolChoice(choice *ToolChoice)       { m.toolChoice = choice }
+func (m *mockConversation) SetSystemCacheControl(cc *CacheControl) { m.systemCache = cc }
+
+func (m *mockConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	return m.respond(content, sampling)
+}
+
+func (m *mockConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	resp, err := m.respond(content, sampling)
+	if err == nil && callback != nil {
+		callback(resp.Text(), false)
+		callback("", true)
+	}
+	return resp, err
+}
+
+func (m *mockConversation) AddRichMessage(role Role, content []ContentBlock) {
+	m.messages = append(m.messages, RichMessage{Role: role, Content: content})
+}
+
+func (m *mockConversation) GetRichMessages() []RichMessage {
+	out := make([]RichMessage, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// TruncateTo implements HistoryEditor.
+func (m *mockConversation) TruncateTo(n int) error {
+	msgs, err := TruncateHistory(m.messages, n)
+	if err != nil {
+		return err
+	}
+	m.messages = msgs
+	return nil
+}
+
+// ReplaceMessage implements HistoryEditor.
+func (m *mockConversation) ReplaceMessage(i int, msg RichMessage) error {
+	msgs, err := ReplaceHistoryMessage(m.messages, i, msg)
+	if err != nil {
+		return err
+	}
+	m.messages = msgs
+	return nil
+}
+
+// RemoveMessage implements HistoryEditor.
+func (m *mockConversation) RemoveMessage(i int) error {
+	msgs, err := RemoveHistoryMessage(m.messages, i)
+	if err != nil {
+		return err
+	}
+	m.messages = msgs
+	return nil
+}
+
+// capsConversation is a mockConversation that reports capabilities.
+type capsConversation struct {
+	*mockConversation
+	caps Capabilities
+}
+
+func (c *capsConversation) GetCapabilities() Capabilities { return c.caps }
+
+// capsFactory is a ConversationFactory producing capsConversations.
+type capsFactory struct{ caps Capabilities }
+
+func (f capsFactory) NewConversation(system string) Conversation {
+	return &capsConversation{mockConversation: newMockConversation(system), caps: f.caps}
+}
+
+// memoryKV is an in-memory KeyValue for tests.
+type memoryKV map[string][]byte
+
+func newMemoryKV() memoryKV { return make(memoryKV) }
+
+func (m memoryKV) Get(key string) ([]byte, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+func (m memoryKV) Set(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryKV) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memoryKV) Keys(prefix string) ([]string, error) {
+	var keys []string
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,404 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ==========================================================================
+// Content Negotiation
+// ==========================================================================
+
+// NegotiationAction is what Negotiate does with a block the provider does
+// not support.
+type NegotiationAction int
+
+const (
+	// NegotiateReject fails with an *UnsupportedContentError.
+	NegotiateReject NegotiationAction = iota
+	// NegotiateStrip removes the block.
+	NegotiateStrip
+	// NegotiateTransform converts the block into something the provider
+	// supports: images are re-encoded or resized when that suffices, rich
+	// tool results are reduced to text (see DowngradeToolResult),
+	// documents become inline text wrapped with their title (see
+	// InlineDocumentText), tool blocks become text, and
+	// anything else becomes a text placeholder. Thinking blocks are
+	// always stripped, since they cannot be represented as text without
+	// changing their meaning.
+	NegotiateTransform
+)
+
+// NegotiationPolicy configures Negotiate.
+type NegotiationPolicy struct {
+	Action NegotiationAction
+	// ExtractText, if set, extracts the text of binary documents such as
+	// PDFs for NegotiateTransform. Binary documents it cannot handle (or
+	// all of them, if nil) become placeholders.
+	ExtractText func(doc *DocumentContent) (string, error)
+}
+
+// NegotiationChange records one change Negotiate made to the content.
+type NegotiationChange struct {
+	// Message is the index of the message, for NegotiateHistory.
+	Message int
+	// Index is the index of the block in the original content.
+	Index int
+	// Type is the original block type.
+	Type ContentType
+	// Action is "stripped", "transformed" or "placeholder".
+	Action string
+	// Reason explains why the block was unsupported.
+	Reason string
+}
+
+// UnsupportedContentError is returned by Negotiate under NegotiateReject.
+type UnsupportedContentError struct {
+	Index  int
+	Type   ContentType
+	Reason string
+}
+
+func (e *UnsupportedContentError) Error() string {
+	return fmt.Sprintf("content block %d (%s) not supported: %s", e.Index, e.Type, e.Reason)
+}
+
+// Negotiate adapts content to a provider's capabilities according to
+// policy, returning the adapted blocks and every change made. Supported
+// blocks are returned unchanged and blocks is never modified. Under
+// NegotiateReject the first unsupported block fails the whole call. Rich
+// tool results sent to a provider with tool use but only text results
+// are downgraded under every policy, keeping tool_use blocks paired.
+func Negotiate(blocks []ContentBlock, caps Capabilities, policy NegotiationPolicy) ([]ContentBlock, []NegotiationChange, error) {
+	var out []ContentBlock
+	var changes []NegotiationChange
+	images := 0
+	for i, block := range blocks {
+		reason := unsupportedReason(block, caps)
+		overLimit := false
+		if reason == "" && block.Type == ContentTypeImage {
+			images++
+			if caps.MaxImagesPerRequest > 0 && images > caps.MaxImagesPerRequest {
+				reason = fmt.Sprintf("more than %d images per request", caps.MaxImagesPerRequest)
+				overLimit = true
+			}
+		}
+		if reason == "" && block.Type == ContentTypeToolResult && block.ToolResult != nil && len(block.ToolResult.Blocks) > 0 {
+			// Negotiate the blocks inside rich tool results too.
+			inner, innerChanges, err := Negotiate(block.ToolResult.Blocks, caps, policy)
+			var unsupported *UnsupportedContentError
+			if errors.As(err, &unsupported) {
+				return nil, nil, &UnsupportedContentError{Index: i, Type: block.Type,
+					Reason: fmt.Sprintf("tool result block %d (%s): %s", unsupported.Index, unsupported.Type, unsupported.Reason)}
+			}
+			if len(innerChanges) > 0 {
+				result := *block.ToolResult
+				result.Blocks = inner
+				result.Content = result.Text()
+				block.ToolResult = &result
+				for _, c := range innerChanges {
+					c.Index = i
+					c.Reason = "in tool result: " + c.Reason
+					changes = append(changes, c)
+				}
+			}
+		}
+		if reason == "" {
+			out = append(out, block)
+			continue
+		}
+		change := NegotiationChange{Index: i, Type: block.Type, Reason: reason}
+		if block.Type == ContentTypeToolResult && caps.SupportsToolUse {
+			// A rich tool result is always downgraded, whatever the
+			// policy, so its tool_use is never left unanswered.
+			out = append(out, DowngradeToolResult(block))
+			change.Action = "transformed"
+			changes = append(changes, change)
+			continue
+		}
+		switch policy.Action {
+		case NegotiateReject:
+			return nil, nil, &UnsupportedContentError{Index: i, Type: block.Type, Reason: reason}
+		case NegotiateStrip:
+			change.Action = "stripped"
+		default:
+			if overLimit {
+				mediaType := MediaType("unknown type")
+				if block.Image != nil {
+					mediaType = block.Image.Source.MediaType
+				}
+				out = append(out, *placeholderBlock("image", mediaType))
+				change.Action = "placeholder"
+				break
+			}
+			replacement, action := transformBlock(block, caps, policy)
+			change.Action = action
+			if replacement != nil {
+				out = append(out, *replacement)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return out, changes, nil
+}
+
+// NegotiateHistory adapts a whole conversation history to a provider's
+// capabilities, for provider implementations building a request. Stored
+// and replayed history is kept exact and adapted only here, when it is
+// sent. Each message is negotiated as by Negotiate; in addition, images
+// in assistant messages become text placeholders when caps lacks
+// SupportsImageOutput, since such providers reject images outside user
+// messages. msgs is not modified.
+func NegotiateHistory(msgs []RichMessage, caps Capabilities, policy NegotiationPolicy) ([]RichMessage, []NegotiationChange, error) {
+	out := make([]RichMessage, len(msgs))
+	var changes []NegotiationChange
+	for i, msg := range msgs {
+		if msg.Role == RoleAssistant && !caps.SupportsImageOutput {
+			for j, block := range msg.Content {
+				if block.Type == ContentTypeImage && block.Image != nil {
+					changes = append(changes, NegotiationChange{Message: i, Index: j, Type: block.Type,
+						Action: "transformed", Reason: "provider does not accept images from the assistant"})
+				}
+			}
+			msg = AssistantImagesToText([]RichMessage{msg})[0]
+		}
+		content, msgChanges, err := Negotiate(msg.Content, caps, policy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		for _, c := range msgChanges {
+			c.Message = i
+			changes = append(changes, c)
+		}
+		out[i] = RichMessage{Role: msg.Role, Content: content}
+	}
+	return out, changes, nil
+}
+
+// unsupportedReason returns why caps cannot accept block, or "" if it can.
+func unsupportedReason(block ContentBlock, caps Capabilities) string {
+	switch block.Type {
+	case ContentTypeImage:
+		if !caps.SupportsImages {
+			return "provider does not support images"
+		}
+		if block.Image == nil {
+			return ""
+		}
+		src := block.Image.Source
+		if !imageTypeAllowed(caps, src.MediaType) {
+			return fmt.Sprintf("image type %s not supported", src.MediaType)
+		}
+		if src.Type == "base64" && caps.MaxImageSize > 0 {
+			if size := int64(base64.StdEncoding.DecodedLen(len(src.Data))); size > caps.MaxImageSize {
+				return fmt.Sprintf("image of %d bytes exceeds limit of %d", size, caps.MaxImageSize)
+			}
+		}
+	case ContentTypeDocument:
+		if !caps.SupportsDocuments {
+			return "provider does not support documents"
+		}
+	case ContentTypeAudio:
+		if !caps.SupportsAudio {
+			return "provider does not support audio"
+		}
+		if block.Audio == nil {
+			return ""
+		}
+		mediaType := block.Audio.Source.MediaType
+		if len(caps.SupportedAudioTypes) > 0 && !containsString(caps.SupportedAudioTypes, string(mediaType)) {
+			return fmt.Sprintf("audio type %s not supported", mediaType)
+		}
+		if src := block.Audio.Source; src.Type == "base64" && caps.MaxAudioSize > 0 {
+			if size := int64(base64.StdEncoding.DecodedLen(len(src.Data))); size > caps.MaxAudioSize {
+				return fmt.Sprintf("audio of %d bytes exceeds limit of %d", size, caps.MaxAudioSize)
+			}
+		}
+		if caps.MaxAudioDuration > 0 && block.Audio.Duration > caps.MaxAudioDuration {
+			return fmt.Sprintf("audio of %v exceeds limit of %v", block.Audio.Duration, caps.MaxAudioDuration)
+		}
+	case ContentTypeToolUse, ContentTypeToolResult,
+		ContentTypeServerToolUse, ContentTypeWebSearchToolResult, ContentTypeCodeExecutionToolResult:
+		if !caps.SupportsToolUse {
+			return "provider does not support tool use"
+		}
+		if block.ToolResult != nil && len(block.ToolResult.Blocks) > 0 && !caps.SupportsRichToolResults {
+			return "provider only accepts text tool results"
+		}
+	case ContentTypeThinking, ContentTypeRedactedThinking:
+		if !caps.SupportsThinking {
+			return "provider does not support thinking"
+		}
+	}
+	return ""
+}
+
+// transformBlock converts an unsupported block for NegotiateTransform. It
+// returns the replacement (nil to drop the block) and the change action.
+func transformBlock(block ContentBlock, caps Capabilities, policy NegotiationPolicy) (*ContentBlock, string) {
+	switch block.Type {
+	case ContentTypeImage:
+		if caps.SupportsImages && block.Image != nil && block.Image.Source.Type == "base64" {
+			if data, err := base64.StdEncoding.DecodeString(block.Image.Source.Data); err == nil {
+				if converted, err := NewImageBlockFromReader(bytes.NewReader(data), caps); err == nil {
+					converted.CacheControl = block.CacheControl
+					return &converted, "transformed"
+				}
+			}
+		}
+		mediaType := MediaType("unknown type")
+		if block.Image != nil {
+			mediaType = block.Image.Source.MediaType
+		}
+		return placeholderBlock("image", mediaType), "placeholder"
+	case ContentTypeDocument:
+		if block.Document == nil {
+			return placeholderBlock("document", "unknown type"), "placeholder"
+		}
+		text, ok := DocumentText(block.Document)
+		if !ok && policy.ExtractText != nil {
+			var err error
+			text, err = policy.ExtractText(block.Document)
+			ok = err == nil
+		}
+		if ok {
+			replacement := NewTextBlock(InlineDocumentText(block.Document, text))
+			return &replacement, "transformed"
+		}
+		return placeholderBlock("document", block.Document.Source.MediaType), "placeholder"
+	case ContentTypeAudio:
+		mediaType := MediaType("unknown type")
+		if block.Audio != nil {
+			mediaType = block.Audio.Source.MediaType
+		}
+		return placeholderBlock("audio", mediaType), "placeholder"
+	case ContentTypeToolUse:
+		if block.ToolUse != nil {
+			replacement := NewTextBlock(fmt.Sprintf("[called %s(%s)]", block.ToolUse.Name, block.ToolUse.Input))
+			return &replacement, "transformed"
+		}
+	case ContentTypeToolResult:
+		if block.ToolResult == nil {
+			break
+		}
+		if caps.SupportsToolUse {
+			replacement := DowngradeToolResult(block)
+			return &replacement, "transformed"
+		}
+		replacement := NewTextBlock(fmt.Sprintf("[tool result: %s]", block.ToolResult.Text()))
+		return &replacement, "transformed"
+	case ContentTypeServerToolUse, ContentTypeWebSearchToolResult, ContentTypeCodeExecutionToolResult:
+		if text := serverToolText(block); text != "" {
+			replacement := NewTextBlock(text)
+			return &replacement, "transformed"
+		}
+	}
+	return nil, "stripped"
+}
+
+func placeholderBlock(kind string, mediaType MediaType) *ContentBlock {
+	block := NewTextBlock(fmt.Sprintf("[%s omitted: %s]", kind, mediaType))
+	return &block
+}
+
+// ==========================================================================
+// Negotiating Decorator
+// ==========================================================================
+
+// NegotiatingConversation wraps a Conversation and negotiates the content
+// of every rich send, and of rich messages added with AddRichMessage,
+// against the provider's capabilities. Plain text is forwarded unchanged.
+type NegotiatingConversation struct {
+	Conversation
+	caps   Capabilities
+	policy NegotiationPolicy
+
+	mu          sync.Mutex
+	lastChanges []NegotiationChange
+	err         error
+}
+
+// WithNegotiation wraps conv so rich content is adapted to caps, usually
+// the wrapped conversation's own GetCapabilities, according to policy.
+func WithNegotiation(conv Conversation, caps Capabilities, policy NegotiationPolicy) *NegotiatingConversation {
+	return &NegotiatingConversation{Conversation: conv, caps: caps, policy: policy}
+}
+
+// LastChanges returns the changes made to the content of the most recent
+// rich send or added message, or nil if none were needed.
+func (nc *NegotiatingConversation) LastChanges() []NegotiationChange {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.lastChanges
+}
+
+func (nc *NegotiatingConversation) negotiate(content []ContentBlock) ([]ContentBlock, error) {
+	out, changes, err := Negotiate(content, nc.caps, nc.policy)
+	nc.mu.Lock()
+	nc.lastChanges = changes
+	nc.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 && len(content) > 0 {
+		return nil, fmt.Errorf("no content left after negotiation: %s", describeChanges(changes))
+	}
+	return out, nil
+}
+
+// describeChanges summarizes changes for error messages.
+func describeChanges(changes []NegotiationChange) string {
+	parts := make([]string, len(changes))
+	for i, c := range changes {
+		parts[i] = fmt.Sprintf("%s %s", c.Action, c.Type)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SendRich negotiates content, then forwards to the wrapped conversation.
+func (nc *NegotiatingConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	content, err := nc.negotiate(content)
+	if err != nil {
+		return nil, err
+	}
+	return nc.Conversation.SendRich(content, sampling)
+}
+
+// SendRichStreaming negotiates content, then forwards to the wrapped conversation.
+func (nc *NegotiatingConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	content, err := nc.negotiate(content)
+	if err != nil {
+		return nil, err
+	}
+	return nc.Conversation.SendRichStreaming(content, sampling, callback)
+}
+
+// AddRichMessage negotiates content, then adds it to the wrapped
+// conversation. If negotiation fails the message is added unchanged and
+// the error is reported by Err.
+func (nc *NegotiatingConversation) AddRichMessage(role Role, content []ContentBlock) {
+	negotiated, err := nc.negotiate(content)
+	if err != nil {
+		nc.mu.Lock()
+		if nc.err == nil {
+			nc.err = err
+		}
+		nc.mu.Unlock()
+		negotiated = content
+	}
+	nc.Conversation.AddRichMessage(role, negotiated)
+}
+
+// Err returns the first error from negotiating an added message, if any,
+// and clears it.
+func (nc *NegotiatingConversation) Err() error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	err := nc.err
+	nc.err = nil
+	return err
+}
@@ -0,0 +1,176 @@
+package llmapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestNegotiate tests adapting content to provider capabilities.
+func TestNegotiate(t *testing.T) {
+	doc := ContentBlock{Type: ContentTypeDocument, Document: &DocumentContent{
+		Source: DocumentSource{Type: "base64", MediaType: MediaTypePDF, Data: "JVBERi0="},
+	}}
+	blocks := []ContentBlock{
+		NewTextBlock("look at these"),
+		NewImageBlock(MediaTypePNG, "aGVsbG8="),
+		doc,
+		NewThinkingBlock("hmm"),
+	}
+	textOnly := Capabilities{}
+
+	t.Run("Supported", func(t *testing.T) {
+		caps := Capabilities{SupportsImages: true, SupportsDocuments: true, SupportsThinking: true}
+		out, changes, err := Negotiate(blocks, caps, NegotiationPolicy{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(out) != len(blocks) || len(changes) != 0 {
+			t.Errorf("Expected content unchanged, got %d blocks and changes %+v", len(out), changes)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		_, _, err := Negotiate(blocks, textOnly, NegotiationPolicy{Action: NegotiateReject})
+		var unsupported *UnsupportedContentError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("Expected *UnsupportedContentError, got %v", err)
+		}
+		if unsupported.Index != 1 || unsupported.Type != ContentTypeImage {
+			t.Errorf("Expected image at index 1 to be rejected, got %+v", unsupported)
+		}
+	})
+
+	t.Run("Strip", func(t *testing.T) {
+		out, changes, err := Negotiate(blocks, textOnly, NegotiationPolicy{Action: NegotiateStrip})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(out) != 1 || out[0].Text != "look at these" {
+			t.Errorf("Expected only the text block, got %+v", out)
+		}
+		if len(changes) != 3 {
+			t.Fatalf("Expected 3 changes, got %+v", changes)
+		}
+		for i, want := range []int{1, 2, 3} {
+			if changes[i].Index != want || changes[i].Action != "stripped" {
+				t.Errorf("Change %d: expected index %d stripped, got %+v", i, want, changes[i])
+			}
+		}
+	})
+
+	t.Run("Transform", func(t *testing.T) {
+		policy := NegotiationPolicy{
+			Action: NegotiateTransform,
+			ExtractText: func(doc *DocumentContent) (string, error) {
+				return "document text", nil
+			},
+		}
+		out, changes, err := Negotiate(blocks, textOnly, policy)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := []string{"look at these", "[image omitted: image/png]", "<document>\ndocument text\n</document>"}
+		if len(out) != len(want) {
+			t.Fatalf("Expected %d blocks, got %+v", len(want), out)
+		}
+		for i, text := range want {
+			if out[i].Type != ContentTypeText || out[i].Text != text {
+				t.Errorf("Block %d: expected text %q, got %+v", i, text, out[i])
+			}
+		}
+		actions := []string{"placeholder", "transformed", "stripped"}
+		for i, action := range actions {
+			if changes[i].Action != action {
+				t.Errorf("Change %d: expected %s, got %+v", i, action, changes[i])
+			}
+		}
+	})
+
+	t.Run("TransformImage", func(t *testing.T) {
+		raw := noisyPNG(t, 64, 64)
+		block := NewImageBlock(MediaTypePNG, base64.StdEncoding.EncodeToString(raw))
+		caps := Capabilities{SupportsImages: true, MaxImageSize: int64(len(raw) / 2)}
+		out, changes, err := Negotiate([]ContentBlock{block}, caps, NegotiationPolicy{Action: NegotiateTransform})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(changes) != 1 || changes[0].Action != "transformed" {
+			t.Errorf("Expected image to be transformed, got %+v", changes)
+		}
+		if out[0].Type != ContentTypeImage || len(out[0].Image.Source.Data) >= len(block.Image.Source.Data) {
+			t.Error("Expected a smaller image")
+		}
+	})
+
+	t.Run("ToolBlocks", func(t *testing.T) {
+		tools := []ContentBlock{
+			{Type: ContentTypeToolUse, ToolUse: &ToolUseContent{ID: "t1", Name: "lookup", Input: json.RawMessage(`{"q":1}`)}},
+			NewToolResultBlock("t1", "42", false),
+		}
+		out, _, err := Negotiate(tools, textOnly, NegotiationPolicy{Action: NegotiateTransform})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out[0].Text != `[called lookup({"q":1})]` || out[1].Text != "[tool result: 42]" {
+			t.Errorf("Expected tool blocks as text, got %+v", out)
+		}
+	})
+}
+
+// TestNegotiatingConversation tests negotiation on rich sends.
+func TestNegotiatingConversation(t *testing.T) {
+	mock := newMockConversation("system")
+	conv := WithNegotiation(mock, Capabilities{}, NegotiationPolicy{Action: NegotiateStrip})
+
+	if _, err := conv.SendRich([]ContentBlock{NewTextBlock("hi"), NewImageBlock(MediaTypePNG, "aGVsbG8=")}, Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sent := mock.messages[len(mock.messages)-2]
+	if len(sent.Content) != 1 || sent.Content[0].Text != "hi" {
+		t.Errorf("Expected image to be stripped before sending, got %+v", sent.Content)
+	}
+	if changes := conv.LastChanges(); len(changes) != 1 || changes[0].Type != ContentTypeImage {
+		t.Errorf("Expected one image change, got %+v", changes)
+	}
+
+	if _, err := conv.SendRich([]ContentBlock{NewImageBlock(MediaTypePNG, "aGVsbG8=")}, Sampling{}); err == nil {
+		t.Error("Expected error when nothing is left to send")
+	}
+
+	conv.AddRichMessage(RoleUser, []ContentBlock{NewTextBlock("note"), NewImageBlock(MediaTypePNG, "aGVsbG8=")})
+	if added := mock.messages[len(mock.messages)-1]; len(added.Content) != 1 || added.Content[0].Text != "note" {
+		t.Errorf("Expected image to be stripped from added message, got %+v", added.Content)
+	}
+	if err := conv.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	conv.AddRichMessage(RoleUser, []ContentBlock{NewImageBlock(MediaTypePNG, "aGVsbG8=")})
+	if err := conv.Err(); err == nil {
+		t.Error("Expected Err to report a message with nothing left")
+	}
+}
+
+// TestNegotiateImageLimit tests the per-request image limit.
+func TestNegotiateImageLimit(t *testing.T) {
+	nilImage := ContentBlock{Type: ContentTypeImage}
+	out, _, err := Negotiate([]ContentBlock{nilImage, nilImage}, Capabilities{SupportsImages: true, MaxImagesPerRequest: 1},
+		NegotiationPolicy{Action: NegotiateTransform})
+	if err != nil || len(out) != 2 || out[1].Text != "[image omitted: unknown type]" {
+		t.Errorf("Expected a placeholder for an image without data, got %+v, %v", out, err)
+	}
+
+	img := NewImageBlock(MediaTypePNG, "aGVsbG8=")
+	caps := Capabilities{SupportsImages: true, MaxImagesPerRequest: 2}
+	out, changes, err := Negotiate([]ContentBlock{img, img, img}, caps, NegotiationPolicy{Action: NegotiateTransform})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Index != 2 || changes[0].Action != "placeholder" {
+		t.Errorf("Expected third image replaced by a placeholder, got %+v", changes)
+	}
+	if out[2].Type != ContentTypeText {
+		t.Errorf("Expected placeholder text, got %+v", out[2])
+	}
+}
@@ -0,0 +1,179 @@
+package llmapi
+
+import "fmt"
+
+// PersistentConversation wraps a Conversation and mirrors its history into
+// a Store as it changes. Messages added with AddMessage or AddRichMessage,
+// and the request and response turns of every send, are appended to the
+// stored conversation immediately.
+//
+// A failure to persist a send is returned as the call's error, alongside
+// the successful reply. Failures from AddMessage and AddRichMessage, which
+// cannot return errors, are reported by Err.
+type PersistentConversation struct {
+	Conversation
+	store    Store
+	id       string
+	settings Settings
+	err      error
+}
+
+// WithPersistence wraps conv and stores its current state in store under
+// id, replacing anything stored there. settings are saved with it.
+func WithPersistence(conv Conversation, store Store, id string, settings Settings) (*PersistentConversation, error) {
+	pc := &PersistentConversation{
+		Conversation: conv,
+		store:        store,
+		id:           id,
+		settings:     settings,
+	}
+	if err := pc.Sync(); err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// ResumePersistentConversation restores the conversation stored under id
+// into a new conversation from factory and continues persisting it.
+func ResumePersistentConversation(store Store, id string, factory ConversationFactory) (*PersistentConversation, error) {
+	snap, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &PersistentConversation{
+		Conversation: snap.Restore(factory),
+		store:        store,
+		id:           id,
+		settings:     snap.Settings,
+	}, nil
+}
+
+// ID returns the conversation's store ID.
+func (pc *PersistentConversation) ID() string {
+	return pc.id
+}
+
+// Err returns the first error from persisting an added message, if any,
+// and clears it.
+func (pc *PersistentConversation) Err() error {
+	err := pc.err
+	pc.err = nil
+	return err
+}
+
+// Sync replaces the stored conversation with the full current state,
+// including usage and tools, which are not updated by appends.
+func (pc *PersistentConversation) Sync() error {
+	return pc.store.Put(pc.id, NewSnapshot(pc.Conversation, pc.settings))
+}
+
+// SetModel changes the model and persists the new settings.
+func (pc *PersistentConversation) SetModel(model string) {
+	pc.settings.Model = model
+	pc.Conversation.SetModel(model)
+	pc.keep(pc.Sync())
+}
+
+// SetTools changes the tools and persists them.
+func (pc *PersistentConversation) SetTools(tools []ToolDefinition) {
+	pc.Conversation.SetTools(tools)
+	pc.keep(pc.Sync())
+}
+
+// Clear resets the history and the stored conversation.
+func (pc *PersistentConversation) Clear() {
+	pc.Conversation.Clear()
+	pc.keep(pc.Sync())
+}
+
+// AddMessage adds a message and appends it to the store.
+func (pc *PersistentConversation) AddMessage(role Role, content string) {
+	n := len(pc.GetRichMessages())
+	pc.Conversation.AddMessage(role, content)
+	pc.keep(pc.appendSince(n))
+}
+
+// AddRichMessage adds a message and appends it to the store.
+func (pc *PersistentConversation) AddRichMessage(role Role, content []ContentBlock) {
+	n := len(pc.GetRichMessages())
+	pc.Conversation.AddRichMessage(role, content)
+	pc.keep(pc.appendSince(n))
+}
+
+func (pc *PersistentConversation) keep(err error) {
+	if err != nil && pc.err == nil {
+		pc.err = err
+	}
+}
+
+// appendSince appends every history message from index n onwards.
+func (pc *PersistentConversation) appendSince(n int) error {
+	msgs := pc.GetRichMessages()
+	if len(msgs) <= n {
+		return nil
+	}
+	if err := pc.store.AppendMessages(pc.id, msgs[n:]...); err != nil {
+		return fmt.Errorf("persist conversation %q: %w", pc.id, err)
+	}
+	return nil
+}
+
+func (pc *PersistentConversation) sendText(send func() (string, string, int, int, error)) (string, string, int, int, error) {
+	n := len(pc.GetRichMessages())
+	reply, stopReason, in, out, err := send()
+	if perr := pc.appendSince(n); err == nil {
+		err = perr
+	}
+	return reply, stopReason, in, out, err
+}
+
+func (pc *PersistentConversation) sendRich(send func() (*RichResponse, error)) (*RichResponse, error) {
+	n := len(pc.GetRichMessages())
+	resp, err := send()
+	if perr := pc.appendSince(n); err == nil {
+		err = perr
+	}
+	return resp, err
+}
+
+// Send forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) Send(text string, sampling Sampling) (string, string, int, int, error) {
+	return pc.sendText(func() (string, string, int, int, error) {
+		return pc.Conversation.Send(text, sampling)
+	})
+}
+
+// SendStreaming forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) SendStreaming(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return pc.sendText(func() (string, string, int, int, error) {
+		return pc.Conversation.SendStreaming(text, sampling, callback)
+	})
+}
+
+// SendUntilDone forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) SendUntilDone(text string, sampling Sampling) (string, string, int, int, error) {
+	return pc.sendText(func() (string, string, int, int, error) {
+		return pc.Conversation.SendUntilDone(text, sampling)
+	})
+}
+
+// SendStreamingUntilDone forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) SendStreamingUntilDone(text string, sampling Sampling, callback StreamCallback) (string, string, int, int, error) {
+	return pc.sendText(func() (string, string, int, int, error) {
+		return pc.Conversation.SendStreamingUntilDone(text, sampling, callback)
+	})
+}
+
+// SendRich forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) SendRich(content []ContentBlock, sampling Sampling) (*RichResponse, error) {
+	return pc.sendRich(func() (*RichResponse, error) {
+		return pc.Conversation.SendRich(content, sampling)
+	})
+}
+
+// SendRichStreaming forwards to the wrapped conversation and persists the new turns.
+func (pc *PersistentConversation) SendRichStreaming(content []ContentBlock, sampling Sampling, callback StreamCallback) (*RichResponse, error) {
+	return pc.sendRich(func() (*RichResponse, error) {
+		return pc.Conversation.SendRichStreaming(content, sampling, callback)
+	})
+}
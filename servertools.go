@@ -0,0 +1,94 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Built-in tool types. The date suffix is the tool version.
+const (
+	ToolTypeWebSearch     = "web_search_20250305"
+	ToolTypeCodeExecution = "code_execution_20250522"
+)
+
+// NewBuiltinTool creates a definition for a built-in tool run by the
+// provider, such as NewBuiltinTool(ToolTypeWebSearch, "web_search",
+// map[string]any{"max_uses": 5}). options may be nil.
+func NewBuiltinTool(toolType, name string, options map[string]any) ToolDefinition {
+	return ToolDefinition{Type: toolType, Name: name, Options: options}
+}
+
+// IsBuiltin reports whether the tool is run by the provider.
+func (td ToolDefinition) IsBuiltin() bool {
+	return td.Type != ""
+}
+
+// ServerToolUses returns the server-side tool calls the provider made
+// while producing the response. They need no result from the caller.
+func (rr RichResponse) ServerToolUses() []ToolUseContent {
+	var uses []ToolUseContent
+	for _, block := range rr.Content {
+		if block.Type == ContentTypeServerToolUse && block.ServerToolUse != nil {
+			uses = append(uses, *block.ServerToolUse)
+		}
+	}
+	return uses
+}
+
+// WebSearchResult is one result of a server-side web search.
+type WebSearchResult struct {
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// EncryptedContent is the opaque page content the model can cite.
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+	PageAge          string `json:"page_age,omitempty"`
+}
+
+// ServerToolError is a failure reported by a server-side tool.
+type ServerToolError struct {
+	Type      string `json:"type"`
+	ErrorCode string `json:"error_code"`
+}
+
+func (e *ServerToolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.ErrorCode)
+}
+
+// WebSearchResults decodes the content of a web_search_tool_result. A
+// failed search returns a *ServerToolError.
+func (sr ServerToolResultContent) WebSearchResults() ([]WebSearchResult, error) {
+	var results []WebSearchResult
+	if err := json.Unmarshal(sr.Content, &results); err == nil {
+		return results, nil
+	}
+	var toolErr ServerToolError
+	if err := json.Unmarshal(sr.Content, &toolErr); err != nil || toolErr.ErrorCode == "" {
+		return nil, fmt.Errorf("decode web search result: unexpected content %s", sr.Content)
+	}
+	return nil, &toolErr
+}
+
+// serverToolText renders a server tool block as text, listing web search
+// results by title and URL rather than their encrypted content. It
+// returns "" for blocks with no payload.
+func serverToolText(block ContentBlock) string {
+	switch {
+	case block.Type == ContentTypeServerToolUse && block.ServerToolUse != nil:
+		return fmt.Sprintf("[provider called %s(%s)]", block.ServerToolUse.Name, block.ServerToolUse.Input)
+	case block.Type == ContentTypeWebSearchToolResult && block.ServerToolResult != nil:
+		results, err := block.ServerToolResult.WebSearchResults()
+		if err != nil {
+			return fmt.Sprintf("[web search failed: %v]", err)
+		}
+		lines := make([]string, len(results))
+		for i, r := range results {
+			lines[i] = fmt.Sprintf("%s (%s)", r.Title, r.URL)
+		}
+		return "[web search results: " + strings.Join(lines, "; ") + "]"
+	case block.ServerToolResult != nil:
+		return fmt.Sprintf("[%s: %s]", block.Type, block.ServerToolResult.Content)
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// serverToolResponse is a response in which the provider searched the web.
+func serverToolResponse() *RichResponse {
+	return &RichResponse{Content: []ContentBlock{
+		{Type: ContentTypeServerToolUse, ServerToolUse: &ToolUseContent{
+			ID: "srvtoolu_1", Name: "web_search", Input: json.RawMessage(`{"query":"go release"}`),
+		}},
+		{Type: ContentTypeWebSearchToolResult, ServerToolResult: &ServerToolResultContent{
+			ToolUseID: "srvtoolu_1",
+			Content: json.RawMessage(`[{"type":"web_search_result","url":"https://go.dev/doc/devel/release",` +
+				`"title":"Release History","encrypted_content":"EqgfCioIARgB","page_age":"1 day"}]`),
+		}},
+		NewTextBlock("Go 1.25 is the latest release."),
+	}}
+}
+
+// TestServerToolBlocks tests server-side tool use and result blocks.
+func TestServerToolBlocks(t *testing.T) {
+	resp := serverToolResponse()
+	if resp.HasToolUse() {
+		t.Error("Expected server tool use not to require client action")
+	}
+	if uses := resp.ServerToolUses(); len(uses) != 1 || uses[0].Name != "web_search" {
+		t.Errorf("ServerToolUses() = %+v", uses)
+	}
+
+	results, err := resp.Content[1].ServerToolResult.WebSearchResults()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "Release History" || results[0].EncryptedContent != "EqgfCioIARgB" {
+		t.Errorf("WebSearchResults() = %+v", results)
+	}
+
+	failed := ServerToolResultContent{Content: json.RawMessage(`{"type":"web_search_tool_result_error","error_code":"max_uses_exceeded"}`)}
+	var toolErr *ServerToolError
+	if _, err := failed.WebSearchResults(); !errors.As(err, &toolErr) || toolErr.ErrorCode != "max_uses_exceeded" {
+		t.Errorf("Expected *ServerToolError, got %v", err)
+	}
+
+	if got := renderTranscript([]RichMessage{{Role: RoleAssistant, Content: resp.Content}}); !strings.Contains(got, "Release History (https://go.dev/doc/devel/release)") || strings.Contains(got, "EqgfCioIARgB") {
+		t.Errorf("Unexpected transcript: %s", got)
+	}
+}
+
+// TestServerToolReplay tests that server tool blocks survive history
+// round trips unchanged.
+func TestServerToolReplay(t *testing.T) {
+	conv := newMockConversation("system")
+	conv.AddRichMessage(RoleUser, textContent("What is the latest Go release?"))
+	conv.AddRichMessage(RoleAssistant, serverToolResponse().Content)
+
+	var buf bytes.Buffer
+	if err := SaveSnapshot(&buf, conv, Settings{}); err != nil {
+		t.Fatal(err)
+	}
+	restored, _, err := LoadSnapshot(&buf, mockFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(conv.GetRichMessages())
+	got, _ := json.Marshal(restored.GetRichMessages())
+	if !bytes.Equal(want, got) {
+		t.Errorf("Replayed history differs:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+// TestBuiltinTool tests built-in tool definitions.
+func TestBuiltinTool(t *testing.T) {
+	tool := NewBuiltinTool(ToolTypeWebSearch, "web_search", map[string]any{"max_uses": 5})
+	if !tool.IsBuiltin() {
+		t.Error("Expected built-in tool")
+	}
+	data, err := json.Marshal(tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "input_schema") || !strings.Contains(string(data), `"type":"web_search_20250305"`) {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+	if (ToolDefinition{Name: "lookup", InputSchema: json.RawMessage(`{}`)}).IsBuiltin() {
+		t.Error("Expected custom tool not to be built-in")
+	}
+}
@@ -0,0 +1,192 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SnapshotVersion is the current snapshot schema version. When the schema
+// changes incompatibly, increment it and register a migration from the
+// previous version in snapshotMigrations.
+const SnapshotVersion = 2
+
+// Snapshot is a serializable copy of a conversation's state. Thinking
+// signatures, tool use IDs and all other content block fields are kept
+// verbatim so a restored conversation can continue tool-use turns.
+type Snapshot struct {
+	Version  int              `json:"version"`
+	System   string           `json:"system"`
+	Settings Settings         `json:"settings"`
+	Tools    []ToolDefinition `json:"tools,omitempty"`
+	Messages []RichMessage    `json:"messages"`
+	Usage    Usage            `json:"usage"`
+}
+
+// NewSnapshot captures the state of conv. Conversations do not expose their
+// settings, so the caller supplies them.
+func NewSnapshot(conv Conversation, settings Settings) *Snapshot {
+	return &Snapshot{
+		Version:  SnapshotVersion,
+		System:   conv.GetSystem(),
+		Settings: settings,
+		Tools:    conv.GetTools(),
+		Messages: conv.GetRichMessages(),
+		Usage:    conv.GetUsage(),
+	}
+}
+
+// Restore creates a new conversation from factory and replays the
+// snapshot into it. The model, tools, MaxTokens, ToolChoice and
+// SystemCacheControl (if the conversation implements MaxTokensSetter,
+// ToolChoiceSetter and SystemCacheSetter) are applied. Thinking and the
+// sampling settings have no setter and are not restored; pass them per
+// call through Sampling. Usage cannot be restored into the new
+// conversation's counters; it remains available on the Snapshot. Messages
+// are replayed exactly; content the provider cannot accept is adapted when
+// it is sent (see NegotiateHistory).
+func (s *Snapshot) Restore(factory ConversationFactory) Conversation {
+	conv := factory.NewConversation(s.System)
+	if s.Settings.Model != "" {
+		conv.SetModel(s.Settings.Model)
+	}
+	if s.Settings.MaxTokens > 0 {
+		if setter, ok := conv.(MaxTokensSetter); ok {
+			setter.SetMaxTokens(s.Settings.MaxTokens)
+		}
+	}
+	if len(s.Tools) > 0 {
+		conv.SetTools(s.Tools)
+	}
+	if s.Settings.ToolChoice != nil {
+		if setter, ok := conv.(ToolChoiceSetter); ok {
+			setter.SetToolChoice(s.Settings.ToolChoice)
+		}
+	}
+	if s.Settings.SystemCacheControl != nil {
+		if setter, ok := conv.(SystemCacheSetter); ok {
+			setter.SetSystemCacheControl(s.Settings.SystemCacheControl)
+		}
+	}
+	replayHistory(conv, s.Messages)
+	return conv
+}
+
+// replayHistory adds msgs to conv unchanged.
+func replayHistory(conv Conversation, msgs []RichMessage) {
+	for _, msg := range msgs {
+		conv.AddRichMessage(msg.Role, msg.Content)
+	}
+}
+
+// SaveSnapshot writes a snapshot of conv to w as JSON.
+func SaveSnapshot(w io.Writer, conv Conversation, settings Settings) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewSnapshot(conv, settings))
+}
+
+// ReadSnapshot decodes a snapshot from r, migrating older versions to the
+// current schema.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return migrateSnapshot(raw)
+}
+
+// migrateSnapshot upgrades a raw snapshot to the current schema and
+// decodes it. Snapshots without a version are taken to be version 1.
+func migrateSnapshot(raw map[string]json.RawMessage) (*Snapshot, error) {
+	version := 1
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("decode snapshot version: %w", err)
+		}
+	}
+	if version < 1 || version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	for ; version < SnapshotVersion; version++ {
+		if err := snapshotMigrations[version](raw); err != nil {
+			return nil, fmt.Errorf("migrate snapshot from version %d: %w", version, err)
+		}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	s.Version = SnapshotVersion
+	return &s, nil
+}
+
+// decodeSnapshot decodes and migrates a JSON snapshot.
+func decodeSnapshot(data []byte) (*Snapshot, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return migrateSnapshot(raw)
+}
+
+// LoadSnapshot reads a snapshot from r and restores it into a new
+// conversation created by factory.
+func LoadSnapshot(r io.Reader, factory ConversationFactory) (Conversation, *Snapshot, error) {
+	s, err := ReadSnapshot(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.Restore(factory), s, nil
+}
+
+// snapshotMigrations upgrades a raw snapshot from the keyed version to the
+// next one, in place.
+var snapshotMigrations = map[int]func(raw map[string]json.RawMessage) error{
+	1: migrateSnapshotV1,
+}
+
+// settingsKeysV1 maps the Go field names version 1 used for Settings to
+// the JSON names used since version 2.
+var settingsKeysV1 = map[string]string{
+	"Model":              "model",
+	"MaxTokens":          "max_tokens",
+	"Temperature":        "temperature",
+	"TopP":               "top_p",
+	"TopK":               "top_k",
+	"StopSequences":      "stop_sequences",
+	"Thinking":           "thinking",
+	"ToolChoice":         "tool_choice",
+	"SystemCacheControl": "system_cache_control",
+	"Extra":              "extra",
+}
+
+// migrateSnapshotV1 renames the settings keys of a version 1 snapshot.
+func migrateSnapshotV1(raw map[string]json.RawMessage) error {
+	data, ok := raw["settings"]
+	if !ok {
+		return nil
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("decode settings: %w", err)
+	}
+	renamed := make(map[string]json.RawMessage, len(settings))
+	for key, value := range settings {
+		if name, ok := settingsKeysV1[key]; ok {
+			key = name
+		}
+		renamed[key] = value
+	}
+	data, err := json.Marshal(renamed)
+	if err != nil {
+		return err
+	}
+	raw["settings"] = data
+	return nil
+}
@@ -0,0 +1,100 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSnapshotRoundTrip tests saving and restoring a conversation.
+func TestSnapshotRoundTrip(t *testing.T) {
+	conv := newMockConversation("You are helpful.")
+	conv.SetTools([]ToolDefinition{{Name: "lookup", InputSchema: json.RawMessage(`{"type":"object"}`)}})
+	conv.Send("hi", Sampling{})
+	conv.AddRichMessage(RoleAssistant, []ContentBlock{
+		{Type: ContentTypeThinking, Thinking: &ThinkingContent{Thinking: "hmm", Signature: "sig-123"}},
+		{Type: ContentTypeToolUse, ToolUse: &ToolUseContent{ID: "toolu_1", Name: "lookup", Input: json.RawMessage(`{"q":"x"}`)}},
+	})
+	conv.AddRichMessage(RoleUser, []ContentBlock{NewToolResultBlock("toolu_1", "found", false)})
+
+	var buf bytes.Buffer
+	settings := Settings{Model: "model-b", MaxTokens: 512, SystemCacheControl: NewCacheControl("")}
+	if err := SaveSnapshot(&buf, conv, settings); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restored, snap, err := LoadSnapshot(&buf, mockFactory{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mock := restored.(*mockConversation)
+	if mock.system != "You are helpful." || mock.model != "model-b" || mock.maxTokens != 512 {
+		t.Errorf("Unexpected restored settings: system=%q model=%q maxTokens=%d", mock.system, mock.model, mock.maxTokens)
+	}
+	if mock.systemCache == nil || mock.systemCache.Type != CacheControlEphemeral {
+		t.Errorf("Expected system cache control to be restored, got %+v", mock.systemCache)
+	}
+	if !reflect.DeepEqual(restored.GetRichMessages(), conv.GetRichMessages()) {
+		t.Errorf("Expected history to round-trip exactly")
+	}
+	if len(restored.GetTools()) != 1 {
+		t.Errorf("Expected tools to be restored")
+	}
+	if snap.Usage != conv.GetUsage() {
+		t.Errorf("Expected usage %+v, got %+v", conv.GetUsage(), snap.Usage)
+	}
+}
+
+// TestSnapshotVersions tests version checks when reading snapshots.
+func TestSnapshotVersions(t *testing.T) {
+	snap, err := ReadSnapshot(strings.NewReader(`{"system": "sys", "messages": [
+		{"role": "user", "content": [{"type": "text", "text": "hello"}]}
+	]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if snap.Version != SnapshotVersion || len(snap.Messages) != 1 {
+		t.Errorf("Unexpected snapshot: %+v", snap)
+	}
+
+	// Version 1 stored settings under their Go field names.
+	snap, err = ReadSnapshot(strings.NewReader(`{"version": 1, "settings": {
+		"Model": "old-model", "MaxTokens": 512, "StopSequences": ["END"],
+		"ToolChoice": {"type": "any"}, "SystemCacheControl": {"type": "ephemeral"}
+	}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Settings{
+		Model:              "old-model",
+		MaxTokens:          512,
+		StopSequences:      []string{"END"},
+		ToolChoice:         NewToolChoice(ToolChoiceAny),
+		SystemCacheControl: &CacheControl{Type: CacheControlEphemeral},
+	}
+	if snap.Version != SnapshotVersion || !reflect.DeepEqual(snap.Settings, want) {
+		t.Errorf("Expected migrated settings %+v, got %+v", want, snap.Settings)
+	}
+
+	if _, err := ReadSnapshot(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+
+	// Stores check the version too.
+	dir := t.TempDir()
+	store, err := NewJSONLStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	line := `{"header":{"version":99,"system":"sys"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "future.jsonl"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("future"); err == nil || !strings.Contains(err.Error(), "unsupported snapshot version 99") {
+		t.Errorf("Expected an unsupported version error, got %v", err)
+	}
+}
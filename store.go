@@ -0,0 +1,554 @@
+package llmapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrConversationNotFound is returned by Store implementations when no
+// conversation exists with the requested ID.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Store persists conversations as Snapshots keyed by ID.
+type Store interface {
+	// Get returns the stored conversation, migrated to SnapshotVersion,
+	// or ErrConversationNotFound.
+	Get(id string) (*Snapshot, error)
+	// Put stores a conversation as SnapshotVersion, replacing any
+	// existing one.
+	Put(id string, snap *Snapshot) error
+	// List returns the IDs of all stored conversations, sorted.
+	List() ([]string, error)
+	// Delete removes a conversation. Deleting a missing ID is not an error.
+	Delete(id string) error
+	// AppendMessages appends messages to a stored conversation's history,
+	// or returns ErrConversationNotFound.
+	AppendMessages(id string, msgs ...RichMessage) error
+}
+
+// validateID rejects IDs that are empty or could escape a storage
+// directory.
+func validateID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid conversation ID %q", id)
+	}
+	return nil
+}
+
+// ==========================================================================
+// JSONL Store
+// ==========================================================================
+
+// JSONLStore is a Store that keeps one JSON Lines file per conversation.
+// The first line holds the snapshot header (everything but the history)
+// and each following line holds one message, so appending is cheap.
+type JSONLStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// jsonlRecord is one line of a JSONL conversation file.
+type jsonlRecord struct {
+	Header  *Snapshot    `json:"header,omitempty"`
+	Message *RichMessage `json:"message,omitempty"`
+}
+
+// NewJSONLStore creates a JSONL store in dir, creating it if needed.
+func NewJSONLStore(dir string) (*JSONLStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &JSONLStore{dir: dir}, nil
+}
+
+func (js *JSONLStore) path(id string) string {
+	return filepath.Join(js.dir, id+".jsonl")
+}
+
+// Get implements Store.
+func (js *JSONLStore) Get(id string) (*Snapshot, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	f, err := os.Open(js.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Records are decoded raw so the assembled snapshot can be migrated
+	// according to the header's version.
+	var header map[string]json.RawMessage
+	var msgs []json.RawMessage
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial final line is a torn write; skip it like
+			// AppendMessages does.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec struct {
+			Header  map[string]json.RawMessage `json:"header"`
+			Message json.RawMessage            `json:"message"`
+		}
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", js.path(id), line, err)
+		}
+		switch {
+		case rec.Header != nil:
+			header, msgs = rec.Header, nil
+		case rec.Message != nil && header != nil:
+			msgs = append(msgs, rec.Message)
+		}
+	}
+	if header == nil {
+		return nil, fmt.Errorf("%s: missing header", js.path(id))
+	}
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return nil, err
+	}
+	header["messages"] = data
+	snap, err := migrateSnapshot(header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", js.path(id), err)
+	}
+	return snap, nil
+}
+
+// Put implements Store. The file is rewritten atomically.
+func (js *JSONLStore) Put(id string, snap *Snapshot) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	tmp, err := os.CreateTemp(js.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	header := *snap
+	header.Version = SnapshotVersion
+	header.Messages = nil
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(jsonlRecord{Header: &header}); err != nil {
+		tmp.Close()
+		return err
+	}
+	for i := range snap.Messages {
+		if err := enc.Encode(jsonlRecord{Message: &snap.Messages[i]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), js.path(id))
+}
+
+// List implements Store.
+func (js *JSONLStore) List() ([]string, error) {
+	entries, err := os.ReadDir(js.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, ".jsonl") {
+			ids = append(ids, strings.TrimSuffix(name, ".jsonl"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete implements Store.
+func (js *JSONLStore) Delete(id string) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	err := os.Remove(js.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// AppendMessages implements Store by appending one line per message. A
+// torn line left by an interrupted write is truncated away first.
+func (js *JSONLStore) AppendMessages(id string, msgs ...RichMessage) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	f, err := os.OpenFile(js.path(id), os.O_RDWR|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := truncateTornLine(f); err != nil {
+		f.Close()
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range msgs {
+		if err := enc.Encode(jsonlRecord{Message: &msgs[i]}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// truncateTornLine truncates f to just past its last newline, dropping a
+// partial final line.
+func truncateTornLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for end := info.Size(); end > 0; {
+		start := max(0, end-int64(len(buf)))
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			good := start + int64(i) + 1
+			if good == info.Size() {
+				return nil
+			}
+			return f.Truncate(good)
+		}
+		end = start
+	}
+	return f.Truncate(0)
+}
+
+// ==========================================================================
+// Key-Value Store
+// ==========================================================================
+
+// KeyValue is a minimal embedded key-value database. Adapters for bbolt,
+// Badger, Pebble and similar can implement it to back a KVStore.
+type KeyValue interface {
+	// Get returns the value for key; ok is false if it does not exist.
+	Get(key string) (value []byte, ok bool, err error)
+	// Set stores value under key.
+	Set(key string, value []byte) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Keys returns all keys with the given prefix.
+	Keys(prefix string) ([]string, error)
+}
+
+// KVStore is a Store backed by a KeyValue database. Each conversation is
+// stored as a single JSON value under "conversation/<id>".
+type KVStore struct {
+	kv KeyValue
+	mu sync.Mutex
+}
+
+const kvConversationPrefix = "conversation/"
+
+// NewKVStore creates a Store on top of kv.
+func NewKVStore(kv KeyValue) *KVStore {
+	return &KVStore{kv: kv}
+}
+
+func (ks *KVStore) get(id string) (*Snapshot, error) {
+	data, ok, err := ks.kv.Get(kvConversationPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrConversationNotFound
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode conversation %q: %w", id, err)
+	}
+	return snap, nil
+}
+
+func (ks *KVStore) put(id string, snap *Snapshot) error {
+	stamped := *snap
+	stamped.Version = SnapshotVersion
+	data, err := json.Marshal(&stamped)
+	if err != nil {
+		return err
+	}
+	return ks.kv.Set(kvConversationPrefix+id, data)
+}
+
+// Get implements Store.
+func (ks *KVStore) Get(id string) (*Snapshot, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.get(id)
+}
+
+// Put implements Store.
+func (ks *KVStore) Put(id string, snap *Snapshot) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.put(id, snap)
+}
+
+// List implements Store.
+func (ks *KVStore) List() ([]string, error) {
+	keys, err := ks.kv.Keys(kvConversationPrefix)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = strings.TrimPrefix(k, kvConversationPrefix)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete implements Store.
+func (ks *KVStore) Delete(id string) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	return ks.kv.Delete(kvConversationPrefix + id)
+}
+
+// AppendMessages implements Store with a read-modify-write of the value.
+func (ks *KVStore) AppendMessages(id string, msgs ...RichMessage) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	snap, err := ks.get(id)
+	if err != nil {
+		return err
+	}
+	snap.Messages = append(snap.Messages, msgs...)
+	return ks.put(id, snap)
+}
+
+// FileKV is a simple embedded KeyValue database kept in memory and
+// persisted to an append-only log file, which is replayed on open.
+// Call Compact occasionally to drop superseded records.
+type FileKV struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	data map[string][]byte
+}
+
+// fileKVRecord is one log entry. A nil Value with Deleted set removes Key.
+type fileKVRecord struct {
+	Key     string `json:"k"`
+	Value   []byte `json:"v,omitempty"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+// OpenFileKV opens or creates the database at path. A torn record left
+// by an interrupted write is truncated away before new records are
+// appended after it.
+func OpenFileKV(path string) (*FileKV, error) {
+	fkv := &FileKV{path: path, data: make(map[string][]byte)}
+	good, err := fkv.replay()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() > good {
+		err = f.Truncate(good)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fkv.file = f
+	return fkv, nil
+}
+
+// replay loads the log and returns the offset just past the last complete
+// record.
+func (fkv *FileKV) replay() (int64, error) {
+	f, err := os.Open(fkv.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var good int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial final line is a torn write; drop it.
+			return good, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var rec fileKVRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// Nothing after a corrupt record can be trusted.
+			return good, nil
+		}
+		if rec.Deleted {
+			delete(fkv.data, rec.Key)
+		} else {
+			fkv.data[rec.Key] = rec.Value
+		}
+		good += int64(len(line))
+	}
+}
+
+func (fkv *FileKV) write(rec fileKVRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = fkv.file.Write(append(line, '\n'))
+	return err
+}
+
+// Get implements KeyValue.
+func (fkv *FileKV) Get(key string) ([]byte, bool, error) {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+	v, ok := fkv.data[key]
+	return v, ok, nil
+}
+
+// Set implements KeyValue.
+func (fkv *FileKV) Set(key string, value []byte) error {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+	if err := fkv.write(fileKVRecord{Key: key, Value: value}); err != nil {
+		return err
+	}
+	fkv.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements KeyValue.
+func (fkv *FileKV) Delete(key string) error {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+	if _, ok := fkv.data[key]; !ok {
+		return nil
+	}
+	if err := fkv.write(fileKVRecord{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	delete(fkv.data, key)
+	return nil
+}
+
+// Keys implements KeyValue.
+func (fkv *FileKV) Keys(prefix string) ([]string, error) {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+	var keys []string
+	for k := range fkv.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Compact rewrites the log with only the current value of each key.
+func (fkv *FileKV) Compact() error {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(fkv.path), filepath.Base(fkv.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for k, v := range fkv.data {
+		if err := enc.Encode(fileKVRecord{Key: k, Value: v}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fkv.path); err != nil {
+		return err
+	}
+	fkv.file.Close()
+	fkv.file, err = os.OpenFile(fkv.path, os.O_WRONLY|os.O_APPEND, 0)
+	return err
+}
+
+// Close closes the log file.
+func (fkv *FileKV) Close() error {
+	fkv.mu.Lock()
+	defer fkv.mu.Unlock()
+	return fkv.file.Close()
+}
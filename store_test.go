@@ -0,0 +1,206 @@
+package llmapi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testStore exercises the Store contract.
+func testStore(t *testing.T, store Store) {
+	snap := &Snapshot{
+		Version:  SnapshotVersion,
+		System:   "sys",
+		Settings: Settings{Model: "m"},
+		Messages: []RichMessage{{Role: RoleUser, Content: textContent("hi")}},
+	}
+	if err := store.Put("b", snap); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put("a", &Snapshot{Version: SnapshotVersion}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	extra := RichMessage{Role: RoleAssistant, Content: textContent("hello")}
+	if err := store.AppendMessages("b", extra); err != nil {
+		t.Fatalf("AppendMessages: %v", err)
+	}
+
+	got, err := store.Get("b")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	want := append(snap.Messages, extra)
+	if got.System != "sys" || got.Settings.Model != "m" || !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("Unexpected snapshot: %+v", got)
+	}
+
+	ids, err := store.List()
+	if err != nil || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("Expected IDs [a b], got %v (%v)", ids, err)
+	}
+
+	if err := store.Delete("b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("b"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+	if err := store.AppendMessages("b", extra); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound on append, got %v", err)
+	}
+	if err := store.Put("../escape", snap); err == nil {
+		t.Error("Expected error for invalid ID")
+	}
+}
+
+// TestJSONLStore tests the file-per-conversation JSONL backend.
+func TestJSONLStore(t *testing.T) {
+	store, err := NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testStore(t, store)
+}
+
+// TestKVStore tests the key-value backend, including reopening the log.
+func TestKVStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testStore(t, NewKVStore(kv))
+	if err := kv.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	kv.Set("other", []byte("x"))
+	kv.Close()
+
+	kv, err = OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	defer kv.Close()
+	ids, _ := NewKVStore(kv).List()
+	if !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("Expected [a] after reopen, got %v", ids)
+	}
+	if v, ok, _ := kv.Get("other"); !ok || string(v) != "x" {
+		t.Errorf("Expected value written after compaction to survive reopen")
+	}
+}
+
+// TestFileKVTornWrite tests that records written after a torn write
+// survive the next reopen.
+func TestFileKVTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	kv, err := OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kv.Set("a", []byte("1"))
+	kv.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString(`{"k":"torn","v":"Mj`)
+	f.Close()
+
+	kv, err = OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	if err := kv.Set("b", []byte("2")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	kv.Close()
+
+	kv, err = OpenFileKV(path)
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	defer kv.Close()
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if v, ok, _ := kv.Get(key); !ok || string(v) != want {
+			t.Errorf("Get(%q) = %q, %t; want %q", key, v, ok, want)
+		}
+	}
+	if _, ok, _ := kv.Get("torn"); ok {
+		t.Error("Expected the torn record to be dropped")
+	}
+}
+
+// TestJSONLStoreTornWrite tests that a torn message line is skipped on
+// read and truncated away before the next append.
+func TestJSONLStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewJSONLStore(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	snap := &Snapshot{Messages: []RichMessage{{Role: RoleUser, Content: textContent("hi")}}}
+	if err := store.Put("c", snap); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "c.jsonl"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString(`{"message":{"role":"assistant","content":[{"ty`)
+	f.Close()
+
+	got, err := store.Get("c")
+	if err != nil {
+		t.Fatalf("Get after torn write: %v", err)
+	}
+	if len(got.Messages) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(got.Messages))
+	}
+
+	if err := store.AppendMessages("c", RichMessage{Role: RoleAssistant, Content: textContent("hello")}); err != nil {
+		t.Fatalf("AppendMessages: %v", err)
+	}
+	got, err = store.Get("c")
+	if err != nil {
+		t.Fatalf("Get after append: %v", err)
+	}
+	if len(got.Messages) != 2 || got.Messages[1].Content[0].Text != "hello" {
+		t.Errorf("Expected the appended message after the first, got %+v", got.Messages)
+	}
+}
+
+// TestPersistentConversation tests mirroring history into a store.
+func TestPersistentConversation(t *testing.T) {
+	store, err := NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conv, err := WithPersistence(newMockConversation("sys"), store, "chat-1", Settings{Model: "m"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conv.AddMessage(RoleUser, "context")
+	if _, _, _, _, err := conv.Send("question", Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conv.Err(); err != nil {
+		t.Fatalf("Unexpected persistence error: %v", err)
+	}
+
+	resumed, err := ResumePersistentConversation(store, "chat-1", mockFactory{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(resumed.GetRichMessages(), conv.GetRichMessages()) {
+		t.Errorf("Expected resumed history %+v, got %+v", conv.GetRichMessages(), resumed.GetRichMessages())
+	}
+	if resumed.GetSystem() != "sys" {
+		t.Errorf("Expected system prompt to be restored")
+	}
+}
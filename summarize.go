@@ -0,0 +1,255 @@
+package llmapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SummaryPlacement controls where a Summarizer puts its summary.
+type SummaryPlacement int
+
+const (
+	// SummaryAsExchange inserts the summary as a synthetic user message
+	// followed by an assistant acknowledgement.
+	SummaryAsExchange SummaryPlacement = iota
+	// SummaryAsSystem appends the summary to the system prompt of the
+	// Summarizer's Target, replacing any earlier summary there.
+	SummaryAsSystem
+)
+
+// DefaultSummaryInstructions is the prompt used when Summarizer has none.
+const DefaultSummaryInstructions = "Summarize the conversation transcript above for your own later reference. " +
+	"Keep every fact, decision, name, number and open task; omit pleasantries. " +
+	"Reply with the summary only."
+
+// Summarizer is a TrimStrategy that condenses old turns into a summary
+// written by a separate, typically cheaper, Conversation.
+//
+// It summarizes all but the last KeepRecent messages (rounded to a turn
+// boundary); chain it with another strategy in a TrimChain if the recent
+// messages alone may not fit. Earlier summaries are part of the history
+// and are folded into the next one, so the summary rolls forward. Use it
+// with ContextManager.TriggerTokens to summarize at a token threshold
+// rather than only when the window overflows.
+//
+// If the summarizer conversation fails, Fallback is applied instead and
+// the error is reported by Err.
+type Summarizer struct {
+	// Conversation writes the summaries. It is cleared before each use.
+	Conversation Conversation
+	// Placement is where the summary is inserted.
+	Placement SummaryPlacement
+	// Target is the conversation being trimmed, whose system prompt
+	// receives the summary under SummaryAsSystem. It must implement
+	// SystemSetter; pass the provider conversation, not a decorator.
+	Target Conversation
+	// KeepRecent is how many of the latest messages are never summarized.
+	KeepRecent int
+	// Instructions override DefaultSummaryInstructions.
+	Instructions string
+	// Archive, if set, receives every summarized message under ArchiveID
+	// so the full original history remains available for audit. Synthetic
+	// summary messages are not archived.
+	Archive   Store
+	ArchiveID string
+	// Fallback trims the history if summarization fails.
+	// Defaults to DropOldest.
+	Fallback TrimStrategy
+
+	mu  sync.Mutex
+	err error
+	// baseSystem is Target's system prompt before any summary, and
+	// summary the summary last appended to it.
+	baseSystem string
+	summary    string
+}
+
+// summaryPrefix marks synthetic summary messages.
+const summaryPrefix = "[Summary of earlier conversation]\n"
+
+// summaryAck is the assistant acknowledgement of a summary exchange.
+const summaryAck = "Understood. I'll continue from that summary."
+
+// Err returns the most recent summarization or archive error, and clears it.
+func (s *Summarizer) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *Summarizer) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Trim implements TrimStrategy.
+func (s *Summarizer) Trim(msgs []RichMessage, maxTokens int, count func([]RichMessage) int) ([]RichMessage, []Elision) {
+	if count(msgs) <= maxTokens {
+		return msgs, nil
+	}
+	units := historyUnits(msgs)
+
+	// Summarize up to the latest turn boundary that leaves KeepRecent
+	// messages, starting the kept part with a user message.
+	cut := 0
+	for _, unit := range units[1:] {
+		start := unit[0]
+		if start > len(msgs)-s.KeepRecent {
+			break
+		}
+		if msgs[start].Role == RoleUser {
+			cut = start
+		}
+	}
+	if cut == 0 {
+		return msgs, nil
+	}
+
+	var summary string
+	var err error
+	setter, ok := s.Target.(SystemSetter)
+	if s.Placement == SummaryAsSystem && !ok {
+		err = errors.New("summarizer target cannot set its system prompt")
+	}
+	if err == nil {
+		summary, err = s.summarize(msgs[:cut])
+	}
+	if err == nil {
+		err = s.archive(msgs[:cut])
+	}
+	if err != nil {
+		s.fail(err)
+		fallback := s.Fallback
+		if fallback == nil {
+			fallback = DropOldest{}
+		}
+		return fallback.Trim(msgs, maxTokens, count)
+	}
+
+	var out []RichMessage
+	if s.Placement == SummaryAsSystem {
+		s.setSystemSummary(setter, summary)
+	} else {
+		out = append(out,
+			RichMessage{Role: RoleUser, Content: textContent(summaryPrefix + summary)},
+			RichMessage{Role: RoleAssistant, Content: textContent(summaryAck)},
+		)
+	}
+	out = append(out, msgs[cut:]...)
+
+	elided := make([]Elision, cut)
+	for i := range elided {
+		elided[i] = Elision{Index: i, Action: "summarized", Tokens: estimateBlockTokens(msgs[i].Content)}
+	}
+	return out, elided
+}
+
+// setSystemSummary appends summary to Target's original system prompt.
+func (s *Summarizer) setSystemSummary(setter SystemSetter, summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.summary == "" {
+		s.baseSystem = s.Target.GetSystem()
+	}
+	s.summary = summary
+	system := summaryPrefix + summary
+	if s.baseSystem != "" {
+		system = s.baseSystem + "\n\n" + system
+	}
+	setter.SetSystem(system)
+}
+
+// summarize asks the summarizer conversation to condense msgs, folding in
+// the summary held in the system prompt, if any.
+func (s *Summarizer) summarize(msgs []RichMessage) (string, error) {
+	if s.Conversation == nil {
+		return "", errors.New("summarizer has no conversation")
+	}
+	instructions := s.Instructions
+	if instructions == "" {
+		instructions = DefaultSummaryInstructions
+	}
+	s.mu.Lock()
+	transcript := renderTranscript(msgs)
+	if s.Placement == SummaryAsSystem && s.summary != "" {
+		transcript = "system: " + summaryPrefix + s.summary + "\n" + transcript
+	}
+	s.mu.Unlock()
+	s.Conversation.Clear()
+	reply, _, _, _, err := s.Conversation.SendUntilDone(
+		"<transcript>\n"+transcript+"</transcript>\n\n"+instructions, Sampling{})
+	if err != nil {
+		return "", fmt.Errorf("summarize history: %w", err)
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+// archive appends the summarized messages to the archive store, leaving
+// out earlier synthetic summary exchanges.
+func (s *Summarizer) archive(msgs []RichMessage) error {
+	if s.Archive == nil {
+		return nil
+	}
+	var original []RichMessage
+	for i, msg := range msgs {
+		if isSummaryMessage(msg) || (i > 0 && isSummaryMessage(msgs[i-1]) && msg.ToMessage().Content == summaryAck) {
+			continue
+		}
+		original = append(original, msg)
+	}
+	if len(original) == 0 {
+		return nil
+	}
+	msgs = original
+	err := s.Archive.AppendMessages(s.ArchiveID, msgs...)
+	if errors.Is(err, ErrConversationNotFound) {
+		err = s.Archive.Put(s.ArchiveID, &Snapshot{Version: SnapshotVersion, Messages: msgs})
+	}
+	if err != nil {
+		return fmt.Errorf("archive summarized history: %w", err)
+	}
+	return nil
+}
+
+// isSummaryMessage reports whether msg is a synthetic summary.
+func isSummaryMessage(msg RichMessage) bool {
+	return msg.Role == RoleUser && len(msg.Content) == 1 && msg.Content[0].Type == ContentTypeText &&
+		strings.HasPrefix(msg.Content[0].Text, summaryPrefix)
+}
+
+// renderTranscript renders messages as a plain-text transcript.
+func renderTranscript(msgs []RichMessage) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "%s: ", msg.Role)
+		for _, block := range msg.Content {
+			switch block.Type {
+			case ContentTypeText:
+				b.WriteString(block.Text)
+			case ContentTypeToolUse:
+				if block.ToolUse != nil {
+					fmt.Fprintf(&b, "[called %s(%s)]", block.ToolUse.Name, block.ToolUse.Input)
+				}
+			case ContentTypeToolResult:
+				if block.ToolResult != nil {
+					fmt.Fprintf(&b, "[tool result: %s]", block.ToolResult.Text())
+				}
+			case ContentTypeServerToolUse, ContentTypeWebSearchToolResult, ContentTypeCodeExecutionToolResult:
+				b.WriteString(serverToolText(block))
+			case ContentTypeImage:
+				b.WriteString("[image]")
+			case ContentTypeDocument:
+				b.WriteString("[document]")
+			case ContentTypeAudio:
+				b.WriteString("[audio]")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,130 @@
+package llmapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSummarizer tests rolling summarization through a ContextManager.
+func TestSummarizer(t *testing.T) {
+	summarizerConv := newMockConversation("")
+	summarizerConv.replies = []*RichResponse{{Content: textContent("the user asked six questions"), StopReason: "end_turn"}}
+	archive := NewKVStore(newMemoryKV())
+	summarizer := &Summarizer{
+		Conversation: summarizerConv,
+		KeepRecent:   2,
+		Archive:      archive,
+		ArchiveID:    "audit",
+	}
+	cm := NewContextManager(summarizer)
+	cm.TriggerTokens = 300
+
+	mock := newMockConversation("")
+	for i := 0; i < 6; i++ {
+		mock.AddMessage(RoleUser, longText(30))
+		mock.AddMessage(RoleAssistant, longText(30))
+	}
+	conv := WithContextManager(mock, cm, "unknown-model")
+	if _, _, _, _, err := conv.Send("next", Sampling{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	msgs := mock.GetMessages()
+	if !strings.Contains(msgs[0].Content, "the user asked six questions") || msgs[1].Role != RoleAssistant {
+		t.Errorf("Expected synthetic summary exchange first, got %+v", msgs[:2])
+	}
+	// Summary exchange + the 2 kept messages + the new exchange.
+	if len(msgs) != 6 {
+		t.Errorf("Expected 6 messages after summarization, got %d", len(msgs))
+	}
+	if !strings.Contains(summarizerConv.messages[0].Content[0].Text, "<transcript>") {
+		t.Error("Expected the summarizer to receive the transcript")
+	}
+
+	audit, err := archive.Get("audit")
+	if err != nil || len(audit.Messages) != 10 {
+		t.Errorf("Expected 10 archived messages, got %v (%v)", audit, err)
+	}
+	if report := conv.LastTrim(); report == nil || report.Elisions[0].Action != "summarized" {
+		t.Errorf("Expected summarized elisions, got %+v", report)
+	}
+}
+
+// TestSummarizerSystemPlacement tests appending rolling summaries to the
+// system prompt, and archiving only original messages.
+func TestSummarizerSystemPlacement(t *testing.T) {
+	summarizerConv := newMockConversation("")
+	summarizerConv.replies = []*RichResponse{
+		{Content: textContent("first summary"), StopReason: "end_turn"},
+		{Content: textContent("second summary"), StopReason: "end_turn"},
+	}
+	target := newMockConversation("Be brief.")
+	archive := NewKVStore(newMemoryKV())
+	summarizer := &Summarizer{
+		Conversation: summarizerConv,
+		Placement:    SummaryAsSystem,
+		Target:       target,
+		KeepRecent:   1,
+		Archive:      archive,
+		ArchiveID:    "audit",
+	}
+	msgs := []RichMessage{
+		{Role: RoleUser, Content: textContent(longText(100))},
+		{Role: RoleAssistant, Content: textContent(longText(100))},
+		{Role: RoleUser, Content: textContent("hi")},
+	}
+	out, elided := summarizer.Trim(msgs, 50, historyTokens)
+	if len(out) != 1 || out[0].Role != RoleUser || len(elided) != 2 {
+		t.Errorf("Expected only the kept message, got %+v", out)
+	}
+	if want := "Be brief.\n\n" + summaryPrefix + "first summary"; target.GetSystem() != want {
+		t.Errorf("GetSystem() = %q, want %q", target.GetSystem(), want)
+	}
+
+	msgs = append(out,
+		RichMessage{Role: RoleAssistant, Content: textContent(longText(100))},
+		RichMessage{Role: RoleUser, Content: textContent("again")})
+	summarizer.Trim(msgs, 10, historyTokens)
+	if want := "Be brief.\n\n" + summaryPrefix + "second summary"; target.GetSystem() != want {
+		t.Errorf("Expected the summary replaced, got %q", target.GetSystem())
+	}
+	if !strings.Contains(summarizerConv.messages[0].Content[0].Text, "first summary") {
+		t.Error("Expected the earlier summary to be folded into the next")
+	}
+
+	// A summary exchange from SummaryAsExchange is not archived.
+	exchange := &Summarizer{Conversation: summarizerConv, KeepRecent: 1, Archive: archive, ArchiveID: "exchange"}
+	summarizerConv.replies = []*RichResponse{{Content: textContent("third"), StopReason: "end_turn"}}
+	exchange.Trim([]RichMessage{
+		{Role: RoleUser, Content: textContent(summaryPrefix + "older")},
+		{Role: RoleAssistant, Content: textContent(summaryAck)},
+		{Role: RoleUser, Content: textContent(longText(100))},
+		{Role: RoleAssistant, Content: textContent(longText(100))},
+		{Role: RoleUser, Content: textContent("last")},
+	}, 10, historyTokens)
+	audit, err := archive.Get("exchange")
+	if err != nil || len(audit.Messages) != 2 || isSummaryMessage(audit.Messages[0]) {
+		t.Errorf("Expected only the 2 original messages archived, got %+v (%v)", audit, err)
+	}
+}
+
+// TestSummarizerFallback tests falling back when the summarizer fails.
+func TestSummarizerFallback(t *testing.T) {
+	failing := newMockConversation("")
+	failing.err = errors.New("unavailable")
+	summarizer := &Summarizer{Conversation: failing, Placement: SummaryAsSystem}
+
+	msgs := []RichMessage{
+		{Role: RoleUser, Content: textContent(longText(100))},
+		{Role: RoleAssistant, Content: textContent(longText(100))},
+		{Role: RoleUser, Content: textContent("hi")},
+	}
+	out, elided := summarizer.Trim(msgs, 50, historyTokens)
+	if len(out) != 1 || len(elided) != 2 || elided[0].Action != "dropped" {
+		t.Errorf("Expected DropOldest fallback, got %d messages and %+v", len(out), elided)
+	}
+	if err := summarizer.Err(); err == nil {
+		t.Error("Expected summarization error to be reported")
+	}
+}
@@ -0,0 +1,368 @@
+// Package tokenizer provides a pure-Go byte-pair encoding tokenizer for
+// counting tokens locally, before a request is sent. It loads tiktoken
+// vocabularies (".tiktoken" files) and Hugging Face "tokenizer.json" BPE
+// models.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer encodes text to token IDs with byte-pair encoding. It is safe
+// for concurrent use.
+type Tokenizer struct {
+	// tiktoken: ranks maps raw byte sequences to rank, which is also the ID.
+	ranks map[string]int
+
+	// Hugging Face: vocab maps (byte-level encoded) tokens to IDs and
+	// merges gives the priority of each "left right" pair.
+	vocab     map[string]int
+	merges    map[string]int
+	byteLevel bool
+	unkID     int
+
+	decoder map[int]string
+}
+
+// ==========================================================================
+// Loading
+// ==========================================================================
+
+// LoadTiktoken reads a tiktoken vocabulary: one "<base64 token> <rank>"
+// pair per line.
+func LoadTiktoken(r io.Reader) (*Tokenizer, error) {
+	t := &Tokenizer{ranks: make(map[string]int), decoder: make(map[int]string)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("tiktoken line %d: expected 2 fields, got %d", line, len(fields))
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("tiktoken line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("tiktoken line %d: %w", line, err)
+		}
+		t.ranks[string(token)] = rank
+		t.decoder[rank] = string(token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTiktokenFile reads a tiktoken vocabulary from a file.
+func LoadTiktokenFile(path string) (*Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTiktoken(f)
+}
+
+// hfTokenizer is the subset of tokenizer.json used here.
+type hfTokenizer struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	PreTokenizer json.RawMessage `json:"pre_tokenizer"`
+	Decoder      json.RawMessage `json:"decoder"`
+	Model        struct {
+		Type     string            `json:"type"`
+		Vocab    map[string]int    `json:"vocab"`
+		Merges   []json.RawMessage `json:"merges"`
+		UnkToken *string           `json:"unk_token"`
+	} `json:"model"`
+}
+
+// LoadHuggingFace reads a Hugging Face tokenizer.json with a BPE model.
+// Both the "a b" string and ["a", "b"] array merge formats are accepted.
+func LoadHuggingFace(r io.Reader) (*Tokenizer, error) {
+	var hf hfTokenizer
+	if err := json.NewDecoder(r).Decode(&hf); err != nil {
+		return nil, fmt.Errorf("decode tokenizer.json: %w", err)
+	}
+	if hf.Model.Type != "" && hf.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model type %q", hf.Model.Type)
+	}
+
+	t := &Tokenizer{
+		vocab:     hf.Model.Vocab,
+		merges:    make(map[string]int, len(hf.Model.Merges)),
+		decoder:   make(map[int]string, len(hf.Model.Vocab)),
+		unkID:     -1,
+		byteLevel: bytes.Contains(hf.PreTokenizer, []byte(`"ByteLevel"`)) || bytes.Contains(hf.Decoder, []byte(`"ByteLevel"`)),
+	}
+	for i, raw := range hf.Model.Merges {
+		var pair string
+		if err := json.Unmarshal(raw, &pair); err != nil {
+			var parts []string
+			if err := json.Unmarshal(raw, &parts); err != nil || len(parts) != 2 {
+				return nil, fmt.Errorf("merge %d: invalid format %s", i, raw)
+			}
+			pair = parts[0] + " " + parts[1]
+		}
+		if _, ok := t.merges[pair]; !ok {
+			t.merges[pair] = i
+		}
+	}
+	for token, id := range t.vocab {
+		t.decoder[id] = token
+	}
+	for _, added := range hf.AddedTokens {
+		t.decoder[added.ID] = added.Content
+	}
+	if hf.Model.UnkToken != nil {
+		if id, ok := t.vocab[*hf.Model.UnkToken]; ok {
+			t.unkID = id
+		}
+	}
+	return t, nil
+}
+
+// LoadHuggingFaceFile reads a Hugging Face tokenizer.json from a file.
+func LoadHuggingFaceFile(path string) (*Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadHuggingFace(f)
+}
+
+// ==========================================================================
+// Encoding
+// ==========================================================================
+
+// Encode returns the token IDs for text.
+func (t *Tokenizer) Encode(text string) []int {
+	var ids []int
+	for _, word := range PreTokenize(text) {
+		ids = t.encodeWord(word, ids)
+	}
+	return ids
+}
+
+// Count returns the number of tokens in text.
+func (t *Tokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// Decode returns the text for token IDs. Unknown IDs are skipped.
+func (t *Tokenizer) Decode(ids []int) string {
+	var b strings.Builder
+	for _, id := range ids {
+		b.WriteString(t.decoder[id])
+	}
+	if !t.byteLevel {
+		return b.String()
+	}
+	return string(fromByteLevel(b.String()))
+}
+
+// encodeWord appends the IDs of one pre-tokenized word to ids.
+func (t *Tokenizer) encodeWord(word string, ids []int) []int {
+	if t.ranks != nil {
+		if id, ok := t.ranks[word]; ok {
+			return append(ids, id)
+		}
+		parts := make([]string, len(word))
+		for i := range parts {
+			parts[i] = word[i : i+1]
+		}
+		for _, p := range mergeParts(parts, func(a, b string) (int, bool) {
+			r, ok := t.ranks[a+b]
+			return r, ok
+		}) {
+			if id, ok := t.ranks[p]; ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	if t.byteLevel {
+		word = toByteLevel([]byte(word))
+	}
+	if id, ok := t.vocab[word]; ok {
+		return append(ids, id)
+	}
+	var parts []string
+	for _, r := range word {
+		parts = append(parts, string(r))
+	}
+	for _, p := range mergeParts(parts, func(a, b string) (int, bool) {
+		r, ok := t.merges[a+" "+b]
+		return r, ok
+	}) {
+		if id, ok := t.vocab[p]; ok {
+			ids = append(ids, id)
+		} else if t.unkID >= 0 {
+			ids = append(ids, t.unkID)
+		}
+	}
+	return ids
+}
+
+// mergeParts repeatedly merges the adjacent pair with the lowest rank
+// until no pair can be merged.
+func mergeParts(parts []string, rank func(a, b string) (int, bool)) []string {
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(parts); i++ {
+			if r, ok := rank(parts[i], parts[i+1]); ok && (best < 0 || r < bestRank) {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// ==========================================================================
+// Pre-tokenization
+// ==========================================================================
+
+// PreTokenize splits text into words the way GPT-style tokenizers do
+// before applying BPE: English contractions, letter runs and punctuation
+// runs with an optional leading space, digit runs of up to three, and
+// whitespace. Concatenating the words yields text.
+func PreTokenize(text string) []string {
+	var words []string
+	for i := 0; i < len(text); {
+		n := wordLength(text[i:])
+		words = append(words, text[i:i+n])
+		i += n
+	}
+	return words
+}
+
+// wordLength returns the byte length of the word at the start of s.
+func wordLength(s string) int {
+	// Contractions: 's 't 're 've 'm 'll 'd
+	if s[0] == '\'' {
+		for _, c := range []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"} {
+			if len(s) >= len(c) && strings.EqualFold(s[:len(c)], c) {
+				return len(c)
+			}
+		}
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+	start := 0
+	if r == ' ' && len(s) > size {
+		next, nextSize := utf8.DecodeRuneInString(s[size:])
+		if !unicode.IsSpace(next) {
+			start = size
+			r, size = next, nextSize
+		}
+	}
+
+	switch {
+	case unicode.IsLetter(r):
+		return start + runLength(s[start:], 0, unicode.IsLetter)
+	case unicode.IsDigit(r):
+		if start > 0 {
+			// Digits do not take a leading space.
+			return start
+		}
+		return runLength(s, 3, unicode.IsDigit)
+	case unicode.IsSpace(r):
+		n := runLength(s, 0, unicode.IsSpace)
+		// Leave the last space to prefix a following word.
+		if n < len(s) && n > 1 && s[n-1] == ' ' {
+			return n - 1
+		}
+		return n
+	default:
+		return start + runLength(s[start:], 0, func(r rune) bool {
+			return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+}
+
+// runLength returns the byte length of the leading run of runes in s
+// matching pred, limited to limit runes if limit > 0.
+func runLength(s string, limit int, pred func(rune) bool) int {
+	n, count := 0, 0
+	for n < len(s) {
+		// Invalid bytes decode as RuneError with size 1.
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !pred(r) || (limit > 0 && count == limit) {
+			break
+		}
+		n += size
+		count++
+	}
+	if n == 0 {
+		_, n = utf8.DecodeRuneInString(s)
+	}
+	return n
+}
+
+// ==========================================================================
+// Byte-level Alphabet
+// ==========================================================================
+
+// byteToRune is the GPT-2 byte-level alphabet: printable bytes map to
+// themselves, the rest to code points from 256 upwards.
+var byteToRune, runeToByte = func() ([256]rune, map[rune]byte) {
+	var b2r [256]rune
+	r2b := make(map[rune]byte, 256)
+	n := 0
+	for b := 0; b < 256; b++ {
+		printable := (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+		if printable {
+			b2r[b] = rune(b)
+		} else {
+			b2r[b] = rune(256 + n)
+			n++
+		}
+		r2b[b2r[b]] = byte(b)
+	}
+	return b2r, r2b
+}()
+
+func toByteLevel(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		b.WriteRune(byteToRune[c])
+	}
+	return b.String()
+}
+
+func fromByteLevel(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if c, ok := runeToByte[r]; ok {
+			out = append(out, c)
+		} else {
+			out = utf8.AppendRune(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tiktokenVocab builds a vocabulary with every single byte plus merges.
+func tiktokenVocab(merges ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	return b.String()
+}
+
+// TestTiktoken tests BPE encoding with a tiktoken vocabulary.
+func TestTiktoken(t *testing.T) {
+	tok, err := LoadTiktoken(strings.NewReader(tiktokenVocab("lo", "low", " lo", " low", "er")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ids := tok.Encode("lower lowest")
+	// "lower" -> low + er ; " lowest" -> " low" + e + s + t
+	want := []int{257, 260, 259, 'e', 's', 't'}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+	if got := tok.Decode(ids); got != "lower lowest" {
+		t.Errorf("Expected round trip, got %q", got)
+	}
+	if n := tok.Count("héllo 😀"); n == 0 {
+		t.Error("Expected non-ASCII text to encode to bytes")
+	}
+
+	if _, err := LoadTiktoken(strings.NewReader("!!! 1\n")); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+}
+
+// TestHuggingFace tests BPE encoding with a byte-level tokenizer.json.
+func TestHuggingFace(t *testing.T) {
+	json := `{
+		"added_tokens": [{"id": 100, "content": "<|end|>"}],
+		"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false},
+		"model": {
+			"type": "BPE",
+			"vocab": {"h": 0, "i": 1, "Ġ": 2, "t": 3, "hi": 4, "Ġt": 5, "Ġthi": 6, "Ġth": 7},
+			"merges": ["h i", ["Ġ", "t"], "Ġt h", "Ġth i"]
+		}
+	}`
+	tok, err := LoadHuggingFace(strings.NewReader(json))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ids := tok.Encode("hi thi")
+	want := []int{4, 6}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+	if got := tok.Decode([]int{4, 6, 100}); got != "hi thi<|end|>" {
+		t.Errorf("Unexpected decode %q", got)
+	}
+
+	if _, err := LoadHuggingFace(strings.NewReader(`{"model": {"type": "WordPiece"}}`)); err == nil {
+		t.Error("Expected error for non-BPE model")
+	}
+}
+
+// TestPreTokenize tests GPT-style word splitting.
+func TestPreTokenize(t *testing.T) {
+	got := PreTokenize("Hello, world! It's 12345  ok")
+	want := []string{"Hello", ",", " world", "!", " It", "'s", " ", "123", "45", " ", " ok"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if strings.Join(got, "") != "Hello, world! It's 12345  ok" {
+		t.Error("Expected words to concatenate to the input")
+	}
+}
+
+// TestInvalidUTF8 tests that invalid UTF-8 input is split and encoded
+// byte for byte.
+func TestInvalidUTF8(t *testing.T) {
+	tok, err := LoadTiktoken(strings.NewReader(tiktokenVocab()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"\xff", "a\xffb", "héllo\x80", " \xfe\xfe x", "12\xc3"} {
+		words := PreTokenize(s)
+		if strings.Join(words, "") != s {
+			t.Errorf("Expected words of %q to concatenate to the input, got %q", s, words)
+		}
+		if n := tok.Count(s); n != len(s) {
+			t.Errorf("Expected %d byte tokens for %q, got %d", len(s), s, n)
+		}
+		if got := tok.Decode(tok.Encode(s)); got != s {
+			t.Errorf("Expected round trip of %q, got %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF for ImageDimensions
+	_ "image/jpeg" // register JPEG for ImageDimensions
+	_ "image/png"  // register PNG for ImageDimensions
+)
+
+// TokenCounter is optionally implemented by Conversation implementations
+// that can count tokens locally, before a request is sent. Implementations
+// typically use the tokenizer package for text and EstimateImageTokens
+// for images; CountContentTokens combines the two.
+type TokenCounter interface {
+	// CountTokens returns the number of input tokens content would use.
+	CountTokens(content []ContentBlock) (int, error)
+}
+
+// Rough token estimates used when no tokenizer is available.
+const (
+	estimatedCharsPerToken = 4
+	estimatedImageTokens   = 1600
+	estimatedDocTokens     = 3000
+	// estimatedAudioTokensPerSecond follows Gemini's published rate;
+	// other providers are similar in magnitude.
+	estimatedAudioTokensPerSecond = 32
+	estimatedAudioTokens          = 30 * estimatedAudioTokensPerSecond
+)
+
+// Image sizing used by EstimateImageTokens.
+const (
+	// imageMaxEdge is the longest edge images are scaled down to.
+	imageMaxEdge = 1568
+	// imagePixelsPerToken is the number of pixels billed as one token.
+	imagePixelsPerToken = 750
+)
+
+// EstimateImageTokens estimates the tokens used by an image of the given
+// pixel dimensions: the image is scaled to fit a 1568 pixel long edge and
+// billed at one token per 750 pixels.
+func EstimateImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		return estimatedImageTokens
+	}
+	if long := max(width, height); long > imageMaxEdge {
+		width = width * imageMaxEdge / long
+		height = height * imageMaxEdge / long
+	}
+	return max(1, (width*height+imagePixelsPerToken-1)/imagePixelsPerToken)
+}
+
+// ImageDimensions returns the pixel dimensions of a base64 image source by
+// decoding its header. PNG, JPEG and GIF are supported; URL sources and
+// other formats return an error.
+func ImageDimensions(src ImageSource) (width, height int, err error) {
+	if src.Type != "base64" {
+		return 0, 0, fmt.Errorf("image source type %q has no inline data", src.Type)
+	}
+	data, err := base64.StdEncoding.DecodeString(src.Data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("decode image data: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("decode image header: %w", err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// CountContentTokens counts the tokens in content, using countText for all
+// text (including tool inputs and results, thinking, and text documents)
+// and EstimateImageTokens for images whose dimensions can be read. Other
+// images and base64 documents use fixed estimates, and audio is estimated
+// from its duration.
+func CountContentTokens(content []ContentBlock, countText func(string) int) int {
+	n := 0
+	for _, block := range content {
+		switch block.Type {
+		case ContentTypeText:
+			n += countText(block.Text)
+		case ContentTypeThinking:
+			if block.Thinking != nil {
+				n += countText(block.Thinking.Thinking)
+			}
+		case ContentTypeRedactedThinking:
+			if block.RedactedThinking != nil {
+				n += estimateTextTokens(block.RedactedThinking.Data)
+			}
+		case ContentTypeToolUse:
+			if block.ToolUse != nil {
+				n += countText(block.ToolUse.Name) + countText(string(block.ToolUse.Input))
+			}
+		case ContentTypeToolResult:
+			if block.ToolResult == nil {
+				continue
+			}
+			if len(block.ToolResult.Blocks) > 0 {
+				n += CountContentTokens(block.ToolResult.Blocks, countText)
+			} else {
+				n += countText(block.ToolResult.Content)
+			}
+		case ContentTypeServerToolUse:
+			if block.ServerToolUse != nil {
+				n += countText(block.ServerToolUse.Name) + countText(string(block.ServerToolUse.Input))
+			}
+		case ContentTypeWebSearchToolResult, ContentTypeCodeExecutionToolResult:
+			if block.ServerToolResult != nil {
+				n += countText(string(block.ServerToolResult.Content))
+			}
+		case ContentTypeImage:
+			if block.Image == nil {
+				continue
+			}
+			w, h, err := ImageDimensions(block.Image.Source)
+			if err != nil {
+				n += estimatedImageTokens
+			} else {
+				n += EstimateImageTokens(w, h)
+			}
+		case ContentTypeAudio:
+			if block.Audio == nil {
+				continue
+			}
+			if seconds := block.Audio.Duration.Seconds(); seconds > 0 {
+				n += int(seconds*estimatedAudioTokensPerSecond + 0.5)
+			} else {
+				n += estimatedAudioTokens
+			}
+		case ContentTypeDocument:
+			if block.Document == nil {
+				continue
+			}
+			switch src := block.Document.Source; src.Type {
+			case "text":
+				n += countText(block.Document.Title) + countText(src.Data)
+			case "content":
+				n += countText(block.Document.Title) + CountContentTokens(src.Content, countText)
+			default:
+				n += estimatedDocTokens
+			}
+		}
+	}
+	return n
+}
+
+// estimateTextTokens is a rough character-based token estimate.
+func estimateTextTokens(text string) int {
+	return (len(text) + estimatedCharsPerToken - 1) / estimatedCharsPerToken
+}
+
+// estimateBlockTokens returns a rough token estimate for content blocks.
+func estimateBlockTokens(blocks []ContentBlock) int {
+	return CountContentTokens(blocks, estimateTextTokens)
+}
+
+// estimateInputTokens estimates the input tokens of sending content on
+// conv: the system prompt, tools, full history and the new content. The
+// conversation's TokenCounter is used if it has one.
+func estimateInputTokens(conv Conversation, content []ContentBlock) int {
+	count := contentCounter(conv)
+	tokens := estimateFixedTokens(conv, content, count)
+	for _, msg := range conv.GetRichMessages() {
+		tokens += count(msg.Content)
+	}
+	return tokens
+}
+
+// estimateFixedTokens estimates the input tokens of sending content on
+// conv other than the history: the system prompt, tools and content.
+func estimateFixedTokens(conv Conversation, content []ContentBlock, count func([]ContentBlock) int) int {
+	tools := ""
+	for _, tool := range conv.GetTools() {
+		tools += tool.Name + tool.Description + string(tool.InputSchema)
+	}
+	return count(textContent(conv.GetSystem()+tools)) + count(content)
+}
+
+// contentCounter returns a function counting content tokens with conv's
+// TokenCounter, falling back to the character estimate if conv has none
+// or it fails.
+func contentCounter(conv Conversation) func([]ContentBlock) int {
+	tc, ok := conv.(TokenCounter)
+	return func(blocks []ContentBlock) int {
+		if ok {
+			if n, err := tc.CountTokens(blocks); err == nil {
+				return n
+			}
+		}
+		return estimateBlockTokens(blocks)
+	}
+}
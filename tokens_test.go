@@ -0,0 +1,59 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngBase64 returns a base64-encoded blank PNG of the given size.
+func pngBase64(t *testing.T, width, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// TestEstimateImageTokens tests token estimates from pixel dimensions.
+func TestEstimateImageTokens(t *testing.T) {
+	tests := []struct {
+		width, height, want int
+	}{
+		{750, 1, 1},
+		{200, 200, 54},
+		{1000, 1000, 1334},
+		{3136, 1568, 1640}, // scaled to 1568x784
+		{0, 0, estimatedImageTokens},
+	}
+	for _, tt := range tests {
+		if got := EstimateImageTokens(tt.width, tt.height); got != tt.want {
+			t.Errorf("EstimateImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+// TestCountContentTokens tests counting with image dimensions.
+func TestCountContentTokens(t *testing.T) {
+	w, h, err := ImageDimensions(ImageSource{Type: "base64", MediaType: MediaTypePNG, Data: pngBase64(t, 200, 100)})
+	if err != nil || w != 200 || h != 100 {
+		t.Fatalf("Expected 200x100, got %dx%d (%v)", w, h, err)
+	}
+	if _, _, err := ImageDimensions(ImageSource{Type: "url", URL: "https://example.com/a.png"}); err == nil {
+		t.Error("Expected error for URL source")
+	}
+
+	words := func(s string) int { return len(strings.Fields(s)) }
+	content := []ContentBlock{
+		NewTextBlock("three word text"),
+		NewImageBlock(MediaTypePNG, pngBase64(t, 200, 200)),
+		NewImageBlockFromURL(MediaTypePNG, "https://example.com/a.png"),
+	}
+	if got, want := CountContentTokens(content, words), 3+54+estimatedImageTokens; got != want {
+		t.Errorf("Expected %d tokens, got %d", want, got)
+	}
+}
@@ -0,0 +1,140 @@
+package llmapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tool choice modes.
+const (
+	// ToolChoiceAuto lets the model decide whether to call tools.
+	ToolChoiceAuto = "auto"
+	// ToolChoiceAny requires the model to call at least one tool.
+	ToolChoiceAny = "any"
+	// ToolChoiceNone forbids tool calls.
+	ToolChoiceNone = "none"
+	// ToolChoiceTool requires the model to call the tool named by Name.
+	ToolChoiceTool = "tool"
+)
+
+// ErrUnknownTool means a ToolChoice names a tool that is not configured.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// ToolChoice controls whether and how the model calls tools. It is set on
+// a conversation with ToolChoiceSetter, in Settings, or per call through
+// Sampling.ToolChoice.
+type ToolChoice struct {
+	// Type is ToolChoiceAuto, ToolChoiceAny, ToolChoiceNone or
+	// ToolChoiceTool. Empty means auto.
+	Type string `json:"type"`
+	// Name is the tool to call when Type is ToolChoiceTool.
+	Name string `json:"name,omitempty"`
+	// DisableParallelToolUse limits the model to at most one tool call per
+	// response (exactly one with ToolChoiceAny or ToolChoiceTool).
+	DisableParallelToolUse bool `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// NewToolChoice returns a tool choice of the given mode.
+func NewToolChoice(mode string) *ToolChoice {
+	return &ToolChoice{Type: mode}
+}
+
+// ForceTool returns a tool choice requiring a call to the named tool.
+func ForceTool(name string) *ToolChoice {
+	return &ToolChoice{Type: ToolChoiceTool, Name: name}
+}
+
+// String returns the mode, with the tool name for ToolChoiceTool.
+func (tc ToolChoice) String() string {
+	s := tc.Type
+	if s == "" {
+		s = ToolChoiceAuto
+	}
+	if tc.Type == ToolChoiceTool {
+		s += ":" + tc.Name
+	}
+	if tc.DisableParallelToolUse {
+		s += " (sequential)"
+	}
+	return s
+}
+
+// Validate checks the tool choice against the configured tools.
+func (tc ToolChoice) Validate(tools []ToolDefinition) error {
+	switch tc.Type {
+	case "", ToolChoiceAuto, ToolChoiceNone:
+		return nil
+	case ToolChoiceAny:
+		if len(tools) == 0 {
+			return errors.New("tool choice \"any\" requires at least one tool")
+		}
+		return nil
+	case ToolChoiceTool:
+		for _, tool := range tools {
+			if tool.Name == tc.Name {
+				return nil
+			}
+		}
+		return fmt.Errorf("tool choice: %w %q", ErrUnknownTool, tc.Name)
+	}
+	return fmt.Errorf("invalid tool choice type %q", tc.Type)
+}
+
+// EmulateToolChoice adapts tools for a provider with no native tool choice
+// or parallel tool control. It returns the tools to offer and an
+// instruction that the caller must append to the system prompt of the
+// request (empty if none is needed); ApplyToolChoice does both. "none"
+// offers no tools, a named tool is offered alone, and "any" and
+// DisableParallelToolUse are requested in the instruction. Emulated
+// choices are requests, not guarantees.
+func EmulateToolChoice(tools []ToolDefinition, choice *ToolChoice) ([]ToolDefinition, string, error) {
+	if choice == nil {
+		return tools, "", nil
+	}
+	if err := choice.Validate(tools); err != nil {
+		return nil, "", err
+	}
+
+	var instruction string
+	switch choice.Type {
+	case ToolChoiceNone:
+		return nil, "", nil
+	case ToolChoiceAny:
+		instruction = "You must respond by calling one of the available tools."
+	case ToolChoiceTool:
+		for _, tool := range tools {
+			if tool.Name == choice.Name {
+				tools = []ToolDefinition{tool}
+				break
+			}
+		}
+		instruction = fmt.Sprintf("You must respond by calling the %s tool.", choice.Name)
+	}
+	if choice.DisableParallelToolUse && len(tools) > 0 {
+		if instruction != "" {
+			instruction += " "
+		}
+		instruction += "Call at most one tool per response."
+	}
+	return tools, instruction, nil
+}
+
+// ApplyToolChoice prepares a request for a provider with no native tool
+// choice: it returns the system prompt with the EmulateToolChoice
+// instruction appended and the tools to offer. Providers call it when
+// building each request, so the conversation's own system prompt and
+// tools are left unchanged.
+func ApplyToolChoice(system string, tools []ToolDefinition, choice *ToolChoice) (string, []ToolDefinition, error) {
+	tools, instruction, err := EmulateToolChoice(tools, choice)
+	if err != nil {
+		return "", nil, err
+	}
+	switch {
+	case instruction == "":
+	case system == "":
+		system = instruction
+	default:
+		system += "\n\n" + instruction
+	}
+	return system, tools, nil
+}
@@ -0,0 +1,135 @@
+package llmapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testTools() []ToolDefinition {
+	return []ToolDefinition{
+		{Name: "search", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		{Name: "calculate", InputSchema: json.RawMessage(`{"type":"object"}`)},
+	}
+}
+
+// TestToolChoiceValidate tests validating tool choices against tools.
+func TestToolChoiceValidate(t *testing.T) {
+	tools := testTools()
+	if err := ForceTool("calculate").Validate(tools); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := ForceTool("missing").Validate(tools); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Expected ErrUnknownTool, got %v", err)
+	}
+	if err := NewToolChoice(ToolChoiceAny).Validate(nil); err == nil {
+		t.Error("Expected error for \"any\" without tools")
+	}
+	if err := NewToolChoice("sometimes").Validate(tools); err == nil {
+		t.Error("Expected error for invalid type")
+	}
+	if got := (ToolChoice{Type: ToolChoiceTool, Name: "search", DisableParallelToolUse: true}).String(); got != "tool:search (sequential)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+// TestEmulateToolChoice tests emulating tool choice for providers without
+// native support.
+func TestEmulateToolChoice(t *testing.T) {
+	tools := testTools()
+	tests := []struct {
+		name        string
+		choice      *ToolChoice
+		wantTools   int
+		instruction string
+	}{
+		{"nil", nil, 2, ""},
+		{"auto", NewToolChoice(ToolChoiceAuto), 2, ""},
+		{"none", NewToolChoice(ToolChoiceNone), 0, ""},
+		{"any", NewToolChoice(ToolChoiceAny), 2, "You must respond by calling one of the available tools."},
+		{"tool", ForceTool("calculate"), 1, "You must respond by calling the calculate tool."},
+		{"sequential", &ToolChoice{DisableParallelToolUse: true}, 2, "Call at most one tool per response."},
+	}
+	for _, tt := range tests {
+		got, instruction, err := EmulateToolChoice(tools, tt.choice)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(got) != tt.wantTools || instruction != tt.instruction {
+			t.Errorf("%s: got %d tools and %q", tt.name, len(got), instruction)
+		}
+	}
+	if got, _, _ := EmulateToolChoice(tools, ForceTool("calculate")); got[0].Name != "calculate" {
+		t.Errorf("Expected only the forced tool, got %+v", got)
+	}
+	if _, _, err := EmulateToolChoice(tools, ForceTool("missing")); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Expected ErrUnknownTool, got %v", err)
+	}
+}
+
+// TestApplyToolChoice tests preparing emulated tool choice requests.
+func TestApplyToolChoice(t *testing.T) {
+	tools := testTools()
+	tests := []struct {
+		name      string
+		system    string
+		choice    *ToolChoice
+		wantTools []string
+		want      string
+	}{
+		{"nil", "Be brief.", nil, []string{"search", "calculate"}, "Be brief."},
+		{"auto", "Be brief.", NewToolChoice(ToolChoiceAuto), []string{"search", "calculate"}, "Be brief."},
+		{"none", "Be brief.", NewToolChoice(ToolChoiceNone), nil, "Be brief."},
+		{"any", "Be brief.", NewToolChoice(ToolChoiceAny), []string{"search", "calculate"},
+			"Be brief.\n\nYou must respond by calling one of the available tools."},
+		{"tool", "Be brief.", ForceTool("calculate"), []string{"calculate"},
+			"Be brief.\n\nYou must respond by calling the calculate tool."},
+		{"no system", "", &ToolChoice{Type: ToolChoiceTool, Name: "search", DisableParallelToolUse: true}, []string{"search"},
+			"You must respond by calling the search tool. Call at most one tool per response."},
+	}
+	for _, tt := range tests {
+		system, got, err := ApplyToolChoice(tt.system, tools, tt.choice)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, tool := range got {
+			names = append(names, tool.Name)
+		}
+		if system != tt.want || !reflect.DeepEqual(names, tt.wantTools) {
+			t.Errorf("%s: expected %q with tools %v, got %q with %v", tt.name, tt.want, tt.wantTools, system, names)
+		}
+	}
+
+	if _, _, err := ApplyToolChoice("Be brief.", tools, ForceTool("missing")); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Expected ErrUnknownTool, got %v", err)
+	}
+	if _, _, err := ApplyToolChoice("Be brief.", nil, NewToolChoice(ToolChoiceAny)); err == nil {
+		t.Error("Expected error for \"any\" without tools")
+	}
+	if _, _, err := ApplyToolChoice("Be brief.", tools, NewToolChoice("sometimes")); err == nil {
+		t.Error("Expected error for invalid type")
+	}
+}
+
+// TestToolChoiceSettings tests restoring a saved tool choice.
+func TestToolChoiceSettings(t *testing.T) {
+	mock := newMockConversation("system")
+	mock.SetTools(testTools())
+
+	var buf bytes.Buffer
+	if err := SaveSnapshot(&buf, mock, Settings{ToolChoice: NewToolChoice(ToolChoiceAny)}); err != nil {
+		t.Fatal(err)
+	}
+	restored, _, err := LoadSnapshot(&buf, mockFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if choice := restored.(*mockConversation).toolChoice; choice == nil || choice.Type != ToolChoiceAny {
+		t.Errorf("Expected restored tool choice \"any\", got %+v", choice)
+	}
+}
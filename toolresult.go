@@ -0,0 +1,45 @@
+package llmapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Text returns the result as a string. For rich results, text blocks are
+// joined with newlines, text documents are inlined with their titles, and
+// images and other documents become placeholders.
+func (tr ToolResultContent) Text() string {
+	if len(tr.Blocks) == 0 {
+		return tr.Content
+	}
+	parts := make([]string, 0, len(tr.Blocks))
+	for _, block := range tr.Blocks {
+		switch {
+		case block.Type == ContentTypeText:
+			parts = append(parts, block.Text)
+		case block.Type == ContentTypeImage && block.Image != nil:
+			parts = append(parts, fmt.Sprintf("[image: %s]", block.Image.Source.MediaType))
+		case block.Type == ContentTypeDocument && block.Document != nil:
+			if text, ok := DocumentText(block.Document); ok {
+				parts = append(parts, InlineDocumentText(block.Document, text))
+			} else {
+				parts = append(parts, fmt.Sprintf("[document: %s]", block.Document.Source.MediaType))
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// DowngradeToolResult returns a copy of a rich tool result block reduced
+// to a string result, for providers that only accept text tool results.
+// Other blocks are returned unchanged.
+func DowngradeToolResult(block ContentBlock) ContentBlock {
+	if block.Type != ContentTypeToolResult || block.ToolResult == nil || len(block.ToolResult.Blocks) == 0 {
+		return block
+	}
+	result := *block.ToolResult
+	result.Content = result.Text()
+	result.Blocks = nil
+	block.ToolResult = &result
+	return block
+}
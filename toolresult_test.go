@@ -0,0 +1,107 @@
+package llmapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// richToolResult is a tool result with text, an image and a text document.
+func richToolResult(t *testing.T) ContentBlock {
+	return NewRichToolResultBlock("toolu_1", []ContentBlock{
+		NewTextBlock("Screenshot taken."),
+		NewImageBlock(MediaTypePNG, pngBase64(t, 8, 8)),
+		NewTextDocumentBlock(MediaTypeText, "page body", "page.txt"),
+	}, false)
+}
+
+// TestRichToolResultText tests the text rendering of rich tool results.
+func TestRichToolResultText(t *testing.T) {
+	block := richToolResult(t)
+	text := block.ToolResult.Text()
+	for _, want := range []string{"Screenshot taken.", "[image: image/png]", `<document title="page.txt">`, "page body"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text() = %q, missing %q", text, want)
+		}
+	}
+	if block.ToolResult.Content != text {
+		t.Errorf("Expected Content to hold the text fallback, got %q", block.ToolResult.Content)
+	}
+
+	plain := NewToolResultBlock("toolu_2", "42", false)
+	if plain.ToolResult.Text() != "42" {
+		t.Errorf("Text() = %q for a string result", plain.ToolResult.Text())
+	}
+}
+
+// TestRichToolResultJSON tests that rich tool results round-trip.
+func TestRichToolResultJSON(t *testing.T) {
+	data, err := json.Marshal(richToolResult(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var block ContentBlock
+	if err := json.Unmarshal(data, &block); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if block.ToolResult == nil || len(block.ToolResult.Blocks) != 3 || block.ToolResult.Blocks[1].Image == nil {
+		t.Errorf("Round trip lost blocks: %+v", block.ToolResult)
+	}
+}
+
+// TestDowngradeToolResult tests reducing rich tool results to strings.
+func TestDowngradeToolResult(t *testing.T) {
+	block := richToolResult(t)
+	down := DowngradeToolResult(block)
+	if down.ToolResult.Blocks != nil || down.ToolResult.Content != block.ToolResult.Text() {
+		t.Errorf("DowngradeToolResult() = %+v", down.ToolResult)
+	}
+	if len(block.ToolResult.Blocks) != 3 {
+		t.Error("Expected the original block to be unchanged")
+	}
+
+	text := NewTextBlock("hi")
+	if got := DowngradeToolResult(text); got.Text != "hi" {
+		t.Errorf("Expected non-tool blocks unchanged, got %+v", got)
+	}
+}
+
+// TestNegotiateRichToolResult tests negotiating rich tool results.
+func TestNegotiateRichToolResult(t *testing.T) {
+	blocks := []ContentBlock{richToolResult(t)}
+
+	// Rich results are downgraded under every policy, so the tool_use
+	// stays answered.
+	textOnly := Capabilities{SupportsToolUse: true}
+	use := ContentBlock{Type: ContentTypeToolUse, ToolUse: &ToolUseContent{ID: "toolu_1", Name: "screenshot", Input: json.RawMessage(`{}`)}}
+	for _, action := range []NegotiationAction{NegotiateReject, NegotiateStrip, NegotiateTransform} {
+		out, changes, err := Negotiate(blocks, textOnly, NegotiationPolicy{Action: action})
+		if err != nil {
+			t.Fatalf("Action %d: unexpected error: %v", action, err)
+		}
+		if len(changes) != 1 || changes[0].Action != "transformed" {
+			t.Errorf("Action %d: unexpected changes: %+v", action, changes)
+		}
+		if len(out) != 1 || out[0].Type != ContentTypeToolResult || out[0].ToolResult.Blocks != nil ||
+			!strings.Contains(out[0].ToolResult.Content, "Screenshot taken.") {
+			t.Fatalf("Action %d: expected a string tool result, got %+v", action, out)
+		}
+		history := []RichMessage{{Role: RoleAssistant, Content: []ContentBlock{use}}, {Role: RoleUser, Content: out}}
+		if err := ValidateToolPairing(history); err != nil {
+			t.Errorf("Action %d: %v", action, err)
+		}
+	}
+
+	// With rich results supported, the inner image is still negotiated.
+	rich := Capabilities{SupportsToolUse: true, SupportsRichToolResults: true}
+	out, changes, err := Negotiate(blocks, rich, NegotiationPolicy{Action: NegotiateStrip})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Index != 0 {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+	if got := len(out[0].ToolResult.Blocks); got != 1 {
+		t.Errorf("Expected 1 remaining inner block, got %d", got)
+	}
+}
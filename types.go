@@ -3,7 +3,11 @@
 // allowing code to swap providers with minimal changes.
 package llmapi
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // ==========================================================================
 // Content Block Types
@@ -19,6 +23,14 @@ const (
 	ContentTypeToolResult ContentType = "tool_result"
 	ContentTypeThinking   ContentType = "thinking"
 	ContentTypeDocument   ContentType = "document"
+
+	ContentTypeRedactedThinking ContentType = "redacted_thinking"
+	ContentTypeAudio            ContentType = "audio"
+
+	// Server-side tools, run by the provider rather than the caller.
+	ContentTypeServerToolUse           ContentType = "server_tool_use"
+	ContentTypeWebSearchToolResult     ContentType = "web_search_tool_result"
+	ContentTypeCodeExecutionToolResult ContentType = "code_execution_tool_result"
 )
 
 // Role identifies the sender of a message.
@@ -41,7 +53,17 @@ const (
 	MediaTypeWebP MediaType = "image/webp"
 
 	// Document types
-	MediaTypePDF MediaType = "application/pdf"
+	MediaTypePDF      MediaType = "application/pdf"
+	MediaTypeText     MediaType = "text/plain"
+	MediaTypeMarkdown MediaType = "text/markdown"
+	MediaTypeHTML     MediaType = "text/html"
+	MediaTypeCSV      MediaType = "text/csv"
+
+	// Audio types
+	MediaTypeWAV  MediaType = "audio/wav"
+	MediaTypeMP3  MediaType = "audio/mpeg"
+	MediaTypeOGG  MediaType = "audio/ogg"
+	MediaTypeFLAC MediaType = "audio/flac"
 )
 
 // ContentBlock represents a single block of content within a message.
@@ -55,6 +77,50 @@ type ContentBlock struct {
 	ToolResult *ToolResultContent `json:"tool_result,omitempty"`
 	Thinking   *ThinkingContent   `json:"thinking,omitempty"`
 	Document   *DocumentContent   `json:"document,omitempty"`
+
+	RedactedThinking *RedactedThinkingContent `json:"redacted_thinking,omitempty"`
+	Audio            *AudioContent            `json:"audio,omitempty"`
+
+	// ServerToolUse is set for ContentTypeServerToolUse and ServerToolResult
+	// for the server tool result types.
+	ServerToolUse    *ToolUseContent          `json:"server_tool_use,omitempty"`
+	ServerToolResult *ServerToolResultContent `json:"server_tool_result,omitempty"`
+
+	// Citations are the document sources supporting a text block.
+	Citations []Citation `json:"citations,omitempty"`
+
+	// CacheControl marks a prompt cache breakpoint after this block.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// ==========================================================================
+// Prompt Caching
+// ==========================================================================
+
+// CacheControlEphemeral is the cache type for short-lived prompt caches.
+const CacheControlEphemeral = "ephemeral"
+
+// CacheControl marks a prompt cache breakpoint: the prompt up to and
+// including the marked block or tool is cached for reuse by later
+// requests. Providers without prompt caching ignore it.
+type CacheControl struct {
+	// Type is the cache type. Currently only CacheControlEphemeral.
+	Type string `json:"type"`
+	// TTL is the optional cache lifetime, eg. "5m" or "1h".
+	// Empty uses the provider's default.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// NewCacheControl returns an ephemeral cache breakpoint with the given TTL.
+// Pass an empty ttl for the provider's default.
+func NewCacheControl(ttl string) *CacheControl {
+	return &CacheControl{Type: CacheControlEphemeral, TTL: ttl}
+}
+
+// WithCacheControl returns a copy of the block marked as a cache breakpoint.
+func (cb ContentBlock) WithCacheControl(cc *CacheControl) ContentBlock {
+	cb.CacheControl = cc
+	return cb
 }
 
 // ==========================================================================
@@ -78,6 +144,29 @@ type ImageSource struct {
 	URL string `json:"url,omitempty"`
 }
 
+// ==========================================================================
+// Audio Content
+// ==========================================================================
+
+// AudioContent represents audio input within a content block.
+type AudioContent struct {
+	Source AudioSource `json:"source"`
+	// Duration is the length of the audio, if known.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// AudioSource contains the actual audio data or reference.
+type AudioSource struct {
+	// Type is the source type: "base64" or "url".
+	Type string `json:"type"`
+	// MediaType is the MIME type of the audio data (MediaTypeWAV, etc.)
+	MediaType MediaType `json:"media_type"`
+	// Data is the base64-encoded audio data. (When Type is "base64".)
+	Data string `json:"data,omitempty"`
+	// URL is the URL of the audio. (When Type is "url".)
+	URL string `json:"url,omitempty"`
+}
+
 // ==========================================================================
 // Tool Use Content
 // ==========================================================================
@@ -96,20 +185,46 @@ type ToolUseContent struct {
 type ToolResultContent struct {
 	// ToolUseID matches the ID from the corresponding ToolUseContent.
 	ToolUseID string `json:"tool_use_id"`
-	// Content is the result of the tool execution.
+	// Content is the result of the tool execution. For rich results it
+	// holds the text of Blocks, for consumers that only read strings.
 	Content string `json:"content"`
+	// Blocks, if set, is the result as text, image and document blocks,
+	// and takes precedence over Content.
+	Blocks []ContentBlock `json:"blocks,omitempty"`
 	// IsError indicates if the tool execution failed.
 	IsError bool `json:"is_error,omitempty"`
 }
 
+// ServerToolResultContent is the result of a tool the provider ran itself,
+// answering a server_tool_use block in the same assistant message. Content
+// is kept as the provider returned it so it can be replayed unchanged.
+type ServerToolResultContent struct {
+	// ToolUseID matches the ID of the server_tool_use block.
+	ToolUseID string `json:"tool_use_id"`
+	// Content is the provider's result payload.
+	Content json.RawMessage `json:"content"`
+}
+
 // ToolDefinition describes a tool that can be called by the assistant.
+//
+// Built-in tools run by the provider, such as web search, are identified
+// by a versioned Type (e.g. ToolTypeWebSearch) and have no InputSchema.
 type ToolDefinition struct {
+	// Type identifies a built-in tool and its version. Empty for tools
+	// implemented by the caller.
+	Type string `json:"type,omitempty"`
 	// Name is the name of the tool.
 	Name string `json:"name"`
 	// Description is a short description of the tool.
-	Description string `json:"description"`
+	Description string `json:"description,omitempty"`
 	// InputSchema is a JSON Schema describing the tool's input parameters.
-	InputSchema json.RawMessage `json:"input_schema"`
+	// Not used by built-in tools.
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+	// Options holds built-in tool parameters, such as "max_uses" for web
+	// search, which providers send alongside the type and name.
+	Options map[string]any `json:"options,omitempty"`
+	// CacheControl marks a prompt cache breakpoint after this tool.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ==========================================================================
@@ -124,26 +239,91 @@ type ThinkingContent struct {
 	Signature string `json:"signature,omitempty"`
 }
 
+// RedactedThinkingContent represents reasoning the provider has encrypted.
+// It cannot be read, but must be passed back unchanged with the rest of
+// the assistant turn, like signed thinking blocks.
+type RedactedThinkingContent struct {
+	// Data is the opaque encrypted reasoning.
+	Data string `json:"data"`
+}
+
+// ThinkingConfig configures extended thinking.
+type ThinkingConfig struct {
+	// Enabled turns extended thinking on.
+	Enabled bool `json:"enabled"`
+	// BudgetTokens is the maximum number of tokens to spend thinking.
+	BudgetTokens int `json:"budget_tokens,omitempty"`
+	// Interleaved allows thinking between tool calls within one turn. The
+	// budget may then exceed MaxTokens, since it spans the whole turn.
+	Interleaved bool `json:"interleaved,omitempty"`
+}
+
+// Validate checks the configuration against the output token limit.
+func (tc ThinkingConfig) Validate(maxTokens int) error {
+	if !tc.Enabled {
+		return nil
+	}
+	if tc.BudgetTokens <= 0 {
+		return fmt.Errorf("thinking budget must be positive, got %d", tc.BudgetTokens)
+	}
+	if !tc.Interleaved && maxTokens > 0 && tc.BudgetTokens >= maxTokens {
+		return fmt.Errorf("thinking budget %d must be less than max tokens %d", tc.BudgetTokens, maxTokens)
+	}
+	return nil
+}
+
+// ResolveThinking returns the thinking configuration for a call:
+// sampling.Thinking if set, otherwise settings.Thinking, validated against
+// settings.MaxTokens. It returns nil if thinking is disabled. Providers
+// call it when building each request.
+func ResolveThinking(settings Settings, sampling Sampling) (*ThinkingConfig, error) {
+	tc := settings.Thinking
+	if sampling.Thinking != nil {
+		tc = sampling.Thinking
+	}
+	if tc == nil || !tc.Enabled {
+		return nil, nil
+	}
+	maxTokens := settings.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultSettings.MaxTokens
+	}
+	if err := tc.Validate(maxTokens); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
 // ==========================================================================
 // Document Content
 // ==========================================================================
 
-// DocumentContent represents embedded documents (PDFs, etc.).
+// DocumentContent represents embedded documents (PDFs, plain text, etc.).
 type DocumentContent struct {
 	// Source specifies how the document is provided
 	Source DocumentSource `json:"source"`
 	// Title is an optional title for the document.
 	Title string `json:"title,omitempty"`
+	// Citations, if enabled, asks the model to cite this document.
+	Citations *CitationsConfig `json:"citations,omitempty"`
+}
+
+// CitationsConfig configures citations for a document.
+type CitationsConfig struct {
+	Enabled bool `json:"enabled"`
 }
 
 // DocumentSource contains document data.
 type DocumentSource struct {
-	// Type is the source type: "base64"
+	// Type is the source type: "base64", "text" or "content".
 	Type string `json:"type"`
 	// MediaType is the MIME type of the document data (MediaTypePDF, etc.)
-	MediaType MediaType `json:"media_type"`
-	// Data is the base64-encoded document data.
-	Data string `json:"data"`
+	MediaType MediaType `json:"media_type,omitempty"`
+	// Data is the base64-encoded document data (when Type is "base64"), or
+	// the document text (when Type is "text").
+	Data string `json:"data,omitempty"`
+	// Content is the document as a list of blocks. (When Type is "content".)
+	Content []ContentBlock `json:"content,omitempty"`
 }
 
 // ==========================================================================
@@ -169,6 +349,20 @@ func (rm RichMessage) ToMessage() Message {
 			if block.Thinking != nil {
 				text += "<thinking>\n" + block.Thinking.Thinking + "\n</thinking>\n"
 			}
+		case ContentTypeImage:
+			// Generated images are noted so text-only histories still
+			// show that the assistant produced one.
+			if rm.Role == RoleAssistant && block.Image != nil {
+				text += generatedImageText(block.Image)
+			}
+		case ContentTypeDocument:
+			// Text documents are inlined with their title; binary
+			// documents have no text to offer.
+			if block.Document != nil {
+				if doc, ok := DocumentText(block.Document); ok {
+					text += InlineDocumentText(block.Document, doc)
+				}
+			}
 		}
 	}
 
@@ -181,7 +375,8 @@ func (rm RichMessage) ToMessage() Message {
 // RichResponse contains the full response from a SendRich operation,
 // including all content blocks, not just text.
 type RichResponse struct {
-	// Content contains all response content blocks.
+	// Content contains all response content blocks, including images
+	// generated by models that support image output.
 	Content []ContentBlock `json:"content"`
 	// StopReason indicates why the generation stopped.
 	StopReason string `json:"stop_reason"`
@@ -189,6 +384,47 @@ type RichResponse struct {
 	InputTokens int `json:"input_tokens"`
 	// OutputTokens is the number of output tokens generated.
 	OutputTokens int `json:"output_tokens"`
+	// CacheCreationInputTokens is the number of input tokens written to
+	// the prompt cache. Not included in InputTokens.
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	// CacheReadInputTokens is the number of input tokens read from the
+	// prompt cache. Not included in InputTokens.
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+	// Metadata identifies and times the call that produced the response.
+	// nil if the provider reports none.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata describes the provider call behind a RichResponse, for
+// debugging and audit. Providers fill the fields they know; use a
+// CallTimer to fill the timings the same way in every call path.
+type Metadata struct {
+	// ResponseID is the provider's identifier for the response message.
+	ResponseID string `json:"response_id,omitempty"`
+	// Model is the model that actually served the request, which may be
+	// more specific than the requested one.
+	Model string `json:"model,omitempty"`
+	// ProviderRequestID is the request ID the provider returned, typically
+	// from a response header, for support requests.
+	ProviderRequestID string `json:"provider_request_id,omitempty"`
+	// Latency is the time from sending the request to the complete response.
+	Latency time.Duration `json:"latency,omitempty"`
+	// TimeToFirstToken is the delay before the first streamed text arrived.
+	// Zero for non-streaming calls.
+	TimeToFirstToken time.Duration `json:"time_to_first_token,omitempty"`
+	// Raw is the provider's response payload. For streaming calls it is the
+	// final message event.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Usage returns the response's token counts as a Usage.
+func (rr RichResponse) Usage() Usage {
+	return Usage{
+		InputTokens:              rr.InputTokens,
+		OutputTokens:             rr.OutputTokens,
+		CacheCreationInputTokens: rr.CacheCreationInputTokens,
+		CacheReadInputTokens:     rr.CacheReadInputTokens,
+	}
 }
 
 // Text returns the concatenated text from the response.
@@ -202,6 +438,30 @@ func (rr RichResponse) Text() string {
 	return text
 }
 
+// Images returns the images generated in the response, in order.
+func (rr RichResponse) Images() []*ImageContent {
+	var images []*ImageContent
+	for _, block := range rr.Content {
+		if block.Type == ContentTypeImage && block.Image != nil {
+			images = append(images, block.Image)
+		}
+	}
+	return images
+}
+
+// ThinkingBlocks returns the thinking and redacted thinking blocks from
+// the response, in order and unmodified. When continuing a tool-use turn,
+// these must be sent back verbatim as part of the assistant message.
+func (rr RichResponse) ThinkingBlocks() []ContentBlock {
+	var blocks []ContentBlock
+	for _, block := range rr.Content {
+		if block.Type == ContentTypeThinking || block.Type == ContentTypeRedactedThinking {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
 // ThinkingText returns the concatenated thinking text from the response.
 func (rr RichResponse) ThinkingText() string {
 	var text string
@@ -281,6 +541,19 @@ func NewToolResultBlock(toolUseID string, content string, isError bool) ContentB
 	}
 }
 
+// NewRichToolResultBlock creates a tool result content block carrying
+// text, image or document blocks. Content is set to the result's text
+// (see ToolResultContent.Text).
+func NewRichToolResultBlock(toolUseID string, content []ContentBlock, isError bool) ContentBlock {
+	result := &ToolResultContent{
+		ToolUseID: toolUseID,
+		Blocks:    content,
+		IsError:   isError,
+	}
+	result.Content = result.Text()
+	return ContentBlock{Type: ContentTypeToolResult, ToolResult: result}
+}
+
 // NewThinkingBlock creates a thinking content block.
 func NewThinkingBlock(thinking string) ContentBlock {
 	return ContentBlock{
@@ -291,6 +564,26 @@ func NewThinkingBlock(thinking string) ContentBlock {
 	}
 }
 
+// NewSignedThinkingBlock creates a thinking content block with a signature,
+// as returned by providers that verify thinking passed back to them.
+func NewSignedThinkingBlock(thinking, signature string) ContentBlock {
+	return ContentBlock{
+		Type: ContentTypeThinking,
+		Thinking: &ThinkingContent{
+			Thinking:  thinking,
+			Signature: signature,
+		},
+	}
+}
+
+// NewRedactedThinkingBlock creates a redacted thinking content block.
+func NewRedactedThinkingBlock(data string) ContentBlock {
+	return ContentBlock{
+		Type:             ContentTypeRedactedThinking,
+		RedactedThinking: &RedactedThinkingContent{Data: data},
+	}
+}
+
 // ==========================================================================
 // Compatibility Detection
 // ==========================================================================
@@ -303,8 +596,29 @@ type Capabilities struct {
 	SupportsToolUse     bool
 	SupportsThinking    bool
 	SupportsStreaming   bool
+	SupportsImageOutput bool     // model can generate images
 	MaxImageSize        int64    // bytes, 0 = no limit
 	SupportedImageTypes []string // eg. ["image/png", "image/jpeg"]
+
+	// Model-level limits; 0 = unknown or no limit.
+	ContextWindow       int // tokens
+	MaxOutputTokens     int
+	MaxImagesPerRequest int
+	MaxDocumentPages    int
+
+	SupportsSystemPrompt      bool
+	SupportsStopSequences     bool
+	SupportsTopK              bool
+	SupportsPromptCaching     bool
+	SupportsParallelToolCalls bool
+	SupportsToolChoice        bool
+	SupportsRichToolResults   bool // tool results may contain images and documents
+	SupportsStructuredOutput  bool
+
+	SupportsAudio       bool
+	MaxAudioSize        int64         // bytes, 0 = no limit
+	MaxAudioDuration    time.Duration // 0 = no limit
+	SupportedAudioTypes []string      // eg. ["audio/wav", "audio/mpeg"]
 }
 
 // Message represents a single message in a conversation.
@@ -317,6 +631,9 @@ type Message struct {
 type Usage struct {
 	InputTokens  int
 	OutputTokens int
+	// Prompt cache writes and reads, not included in InputTokens.
+	CacheCreationInputTokens int
+	CacheReadInputTokens     int
 }
 
 // StreamCallback is called for each token during streaming.
@@ -326,15 +643,23 @@ type StreamCallback func(text string, done bool)
 // Settings configures generation parameters.
 // Provider implementations map these to their native formats.
 type Settings struct {
-	Model         string
-	MaxTokens     int
-	Temperature   float64
-	TopP          float64
-	TopK          int
-	StopSequences []string
+	Model         string   `json:"model,omitempty"`
+	MaxTokens     int      `json:"max_tokens,omitempty"`
+	Temperature   float64  `json:"temperature,omitempty"`
+	TopP          float64  `json:"top_p,omitempty"`
+	TopK          int      `json:"top_k,omitempty"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+
+	// Thinking configures extended thinking. nil = disabled.
+	Thinking *ThinkingConfig `json:"thinking,omitempty"`
+	// ToolChoice controls tool use. nil = auto.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	// SystemCacheControl marks the system prompt as a prompt cache
+	// breakpoint (see SystemCacheSetter). nil = not cached.
+	SystemCacheControl *CacheControl `json:"system_cache_control,omitempty"`
 
 	// Provider-specific extensions
-	Extra map[string]any
+	Extra map[string]any `json:"extra,omitempty"`
 }
 
 // DefaultSettings provides reasonable defaults.
@@ -1,6 +1,10 @@
 package llmapi
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 // TestNewTextBlock tests the NewTextBlock helper constructor.
 func TestNewTextBlock(t *testing.T) {
@@ -285,3 +289,114 @@ func TestContentTypes(t *testing.T) {
 		}
 	}
 }
+
+// TestCacheControl tests cache breakpoint markers and their JSON encoding.
+func TestCacheControl(t *testing.T) {
+	block := NewTextBlock("long context").WithCacheControl(NewCacheControl("1h"))
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"cache_control":{"type":"ephemeral","ttl":"1h"}`) {
+		t.Errorf("Expected cache_control in JSON, got %s", data)
+	}
+
+	data, _ = json.Marshal(NewTextBlock("plain"))
+	if strings.Contains(string(data), "cache_control") {
+		t.Errorf("Expected no cache_control for unmarked block, got %s", data)
+	}
+
+	rr := RichResponse{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 100, CacheReadInputTokens: 200}
+	want := Usage{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 100, CacheReadInputTokens: 200}
+	if rr.Usage() != want {
+		t.Errorf("Expected %+v, got %+v", want, rr.Usage())
+	}
+}
+
+// TestThinkingConfigValidate tests validating thinking budgets.
+func TestThinkingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       ThinkingConfig
+		maxTokens int
+		wantErr   bool
+	}{
+		{"disabled", ThinkingConfig{}, 100, false},
+		{"within budget", ThinkingConfig{Enabled: true, BudgetTokens: 1024}, 4096, false},
+		{"no budget", ThinkingConfig{Enabled: true}, 4096, true},
+		{"budget exceeds max tokens", ThinkingConfig{Enabled: true, BudgetTokens: 4096}, 4096, true},
+		{"interleaved may exceed", ThinkingConfig{Enabled: true, BudgetTokens: 8192, Interleaved: true}, 4096, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate(tt.maxTokens)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %t for max tokens %d, got %v", tt.wantErr, tt.maxTokens, err)
+			}
+		})
+	}
+}
+
+// TestResolveThinking tests choosing and validating a call's thinking
+// configuration.
+func TestResolveThinking(t *testing.T) {
+	settings := Settings{MaxTokens: 4096, Thinking: &ThinkingConfig{Enabled: true, BudgetTokens: 1024}}
+	if tc, err := ResolveThinking(settings, Sampling{}); err != nil || tc != settings.Thinking {
+		t.Errorf("Expected the default configuration, got %+v, %v", tc, err)
+	}
+
+	override := &ThinkingConfig{Enabled: true, BudgetTokens: 2048}
+	if tc, err := ResolveThinking(settings, Sampling{Thinking: override}); err != nil || tc != override {
+		t.Errorf("Expected the per-call configuration, got %+v, %v", tc, err)
+	}
+	if tc, err := ResolveThinking(settings, Sampling{Thinking: &ThinkingConfig{}}); err != nil || tc != nil {
+		t.Errorf("Expected thinking disabled for the call, got %+v, %v", tc, err)
+	}
+
+	if _, err := ResolveThinking(settings, Sampling{Thinking: &ThinkingConfig{Enabled: true, BudgetTokens: 4096}}); err == nil {
+		t.Error("Expected error for a per-call budget exceeding max tokens")
+	}
+	// Without MaxTokens the default limit applies.
+	if _, err := ResolveThinking(Settings{Thinking: &ThinkingConfig{Enabled: true, BudgetTokens: 4096}}, Sampling{}); err == nil {
+		t.Error("Expected error for a budget exceeding the default max tokens")
+	}
+}
+
+// TestRedactedThinkingPreserved tests that signed and redacted thinking
+// round-trip unchanged.
+func TestRedactedThinkingPreserved(t *testing.T) {
+	resp := RichResponse{Content: []ContentBlock{
+		NewSignedThinkingBlock("let me check", "sig-abc"),
+		NewRedactedThinkingBlock("ENCRYPTED=="),
+		NewTextBlock("Checking."),
+		{Type: ContentTypeToolUse, ToolUse: &ToolUseContent{ID: "t1", Name: "lookup", Input: json.RawMessage(`{}`)}},
+	}}
+
+	thinking := resp.ThinkingBlocks()
+	if len(thinking) != 2 || thinking[0].Thinking.Signature != "sig-abc" || thinking[1].RedactedThinking.Data != "ENCRYPTED==" {
+		t.Fatalf("Expected signed and redacted thinking blocks, got %+v", thinking)
+	}
+	if got := resp.ThinkingText(); got != "let me check" {
+		t.Errorf("Expected thinking text 'let me check', got %q", got)
+	}
+
+	// The assistant turn must round-trip unchanged so it can be sent back
+	// alongside the tool result.
+	data, err := json.Marshal(RichMessage{Role: RoleAssistant, Content: resp.Content})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var msg RichMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(msg.Content) != 4 {
+		t.Fatalf("Expected 4 blocks after round trip, got %d", len(msg.Content))
+	}
+	if msg.Content[0].Thinking.Signature != "sig-abc" || msg.Content[1].Type != ContentTypeRedactedThinking || msg.Content[1].RedactedThinking.Data != "ENCRYPTED==" {
+		t.Errorf("Expected thinking to be preserved, got %s", data)
+	}
+	if got := msg.ToMessage().Content; strings.Contains(got, "ENCRYPTED") {
+		t.Errorf("Expected redacted data to be left out of text, got %q", got)
+	}
+}